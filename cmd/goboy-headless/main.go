@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+)
+
+var (
+	frames  = flag.Int("frames", 600, "maximum number of frames to run")
+	until   = flag.String("until", "", "stop once the serial output contains this string")
+	script  = flag.String("input", "", "file containing a scripted input sequence")
+	output  = flag.String("out", "", "write the final frame to this PNG file")
+	dmgMode = flag.Bool("dmg", false, "set to force dmg mode")
+	model   = flag.String("model", "", "hardware model to emulate: dmg0, dmg, mgb, sgb, sgb2, cgb or agb")
+	bootROM = flag.String("bootrom", "", "dmg or cgb boot rom to run before the game")
+	record  = flag.String("record", "", "wav file to record the audio to")
+	stems   = flag.Bool("stems", false, "also record each sound channel to a separate wav file")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <rom>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	rom := flag.Arg(0)
+	if rom == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var inputs inputScript
+	if *script != "" {
+		var err error
+		inputs, err = loadInputScript(*script)
+		if err != nil {
+			log.Fatalf("Failed to load input script: %v", err)
+		}
+	}
+
+	// Stream the serial output to stdout as it is written
+	var serial bytes.Buffer
+	opts := []gb.GameboyOption{
+		gb.WithTransferFunction(func(val byte) {
+			serial.WriteByte(val)
+			os.Stdout.Write([]byte{val})
+		}),
+	}
+	if !*dmgMode {
+		opts = append(opts, gb.WithCGBEnabled())
+	}
+	if *model != "" {
+		m, err := gb.ParseModel(*model)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, gb.WithModel(m))
+	}
+	if *bootROM != "" {
+		data, err := ioutil.ReadFile(*bootROM)
+		if err != nil {
+			log.Fatalf("Failed to load boot rom: %v", err)
+		}
+		opts = append(opts, gb.WithBootROM(data))
+	}
+	if *record != "" {
+		opts = append(opts, gb.WithRecording(*record))
+	}
+	if *stems {
+		opts = append(opts, gb.WithRecordingStems())
+	}
+
+	gameboy, err := gb.NewGameboy(rom, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	reached := false
+	for frame := 0; frame < *frames; frame++ {
+		gameboy.ProcessInput(inputs.forFrame(frame))
+		gameboy.Update()
+
+		if *until != "" && bytes.Contains(serial.Bytes(), []byte(*until)) {
+			reached = true
+			break
+		}
+	}
+
+	if err := gameboy.Flush(); err != nil {
+		log.Printf("Failed to save game: %v", err)
+	}
+	if err := gameboy.StopRecording(); err != nil {
+		log.Printf("Failed to finish recording: %v", err)
+	}
+
+	if *output != "" {
+		if err := writePNG(*output, &gameboy.PreparedData); err != nil {
+			log.Fatalf("Failed to write frame: %v", err)
+		}
+	}
+
+	if *until != "" && !reached {
+		log.Printf("Serial output did not contain %q after %v frames", *until, *frames)
+		os.Exit(1)
+	}
+}
+
+// Write a frame of the screen to a PNG file.
+func writePNG(filename string, screen *[gb.ScreenWidth][gb.ScreenHeight][3]uint8) error {
+	img := image.NewRGBA(image.Rect(0, 0, gb.ScreenWidth, gb.ScreenHeight))
+	for x := 0; x < gb.ScreenWidth; x++ {
+		for y := 0; y < gb.ScreenHeight; y++ {
+			col := screen[x][y]
+			img.Set(x, y, color.RGBA{R: col[0], G: col[1], B: col[2], A: 0xFF})
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+)
+
+// Mapping of the button names used in input scripts.
+var buttonNames = map[string]gb.Button{
+	"a":      gb.ButtonA,
+	"b":      gb.ButtonB,
+	"select": gb.ButtonSelect,
+	"start":  gb.ButtonStart,
+	"right":  gb.ButtonRight,
+	"left":   gb.ButtonLeft,
+	"up":     gb.ButtonUp,
+	"down":   gb.ButtonDown,
+}
+
+// inputScript is a mapping of frame numbers to the buttons which should be
+// pressed and released before that frame is run.
+type inputScript map[int]gb.ButtonInput
+
+// Get the input for a frame.
+func (script inputScript) forFrame(frame int) gb.ButtonInput {
+	return script[frame]
+}
+
+// Load an input script from a file. Each line of the file is in the format
+// `<frame> <press|release> <button>`, for example:
+//
+//	# Press start on the title screen
+//	120 press start
+//	125 release start
+//
+// Empty lines and lines starting with # are ignored.
+func loadInputScript(filename string) (inputScript, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	script := inputScript{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %v: expected `<frame> <press|release> <button>`", line)
+		}
+		frame, err := strconv.Atoi(fields[0])
+		if err != nil || frame < 0 {
+			return nil, fmt.Errorf("line %v: invalid frame %q", line, fields[0])
+		}
+		button, ok := buttonNames[strings.ToLower(fields[2])]
+		if !ok {
+			return nil, fmt.Errorf("line %v: unknown button %q", line, fields[2])
+		}
+
+		input := script[frame]
+		switch strings.ToLower(fields[1]) {
+		case "press":
+			input.Pressed = append(input.Pressed, button)
+		case "release":
+			input.Released = append(input.Released, button)
+		default:
+			return nil, fmt.Errorf("line %v: unknown action %q", line, fields[1])
+		}
+		script[frame] = input
+	}
+	return script, scanner.Err()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/gb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadInputScript asserts that input scripts are parsed into the buttons
+// of each frame, and that malformed lines are reported with their number.
+func TestLoadInputScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goboy-script")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		name     string
+		script   string
+		expected inputScript
+		err      string
+	}{
+		{
+			name:     "empty",
+			script:   "",
+			expected: inputScript{},
+		},
+		{
+			name:   "press and release",
+			script: "120 press start\n125 release start\n",
+			expected: inputScript{
+				120: {Pressed: []gb.Button{gb.ButtonStart}},
+				125: {Released: []gb.Button{gb.ButtonStart}},
+			},
+		},
+		{
+			name:   "same frame",
+			script: "0 press a\n0 press b\n0 release up\n",
+			expected: inputScript{
+				0: {Pressed: []gb.Button{gb.ButtonA, gb.ButtonB}, Released: []gb.Button{gb.ButtonUp}},
+			},
+		},
+		{
+			name:   "comments and whitespace",
+			script: "# Walk right\n\n  10   PRESS   Right  \n\t# Stop\n20 release RIGHT\n",
+			expected: inputScript{
+				10: {Pressed: []gb.Button{gb.ButtonRight}},
+				20: {Released: []gb.Button{gb.ButtonRight}},
+			},
+		},
+		{
+			name:   "every button",
+			script: "1 press a\n1 press b\n1 press select\n1 press start\n1 press right\n1 press left\n1 press up\n1 press down\n",
+			expected: inputScript{
+				1: {Pressed: []gb.Button{
+					gb.ButtonA, gb.ButtonB, gb.ButtonSelect, gb.ButtonStart,
+					gb.ButtonRight, gb.ButtonLeft, gb.ButtonUp, gb.ButtonDown,
+				}},
+			},
+		},
+		{
+			name:   "too few fields",
+			script: "# Comment\n10 press\n",
+			err:    "line 2: expected `<frame> <press|release> <button>`",
+		},
+		{
+			name:   "too many fields",
+			script: "10 press start now\n",
+			err:    "line 1: expected `<frame> <press|release> <button>`",
+		},
+		{
+			name:   "invalid frame",
+			script: "ten press start\n",
+			err:    `line 1: invalid frame "ten"`,
+		},
+		{
+			name:   "negative frame",
+			script: "1 press a\n-1 press a\n",
+			err:    `line 2: invalid frame "-1"`,
+		},
+		{
+			name:   "unknown button",
+			script: "10 press x\n",
+			err:    `line 1: unknown button "x"`,
+		},
+		{
+			name:   "unknown action",
+			script: "10 hold start\n",
+			err:    `line 1: unknown action "hold"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "script.txt")
+			require.NoError(t, ioutil.WriteFile(path, []byte(test.script), 0644))
+
+			script, err := loadInputScript(path)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, script)
+		})
+	}
+}
+
+// TestLoadInputScript_MissingFile asserts that an error is returned when the
+// script file does not exist.
+func TestLoadInputScript_MissingFile(t *testing.T) {
+	_, err := loadInputScript(filepath.Join(os.TempDir(), "goboy-missing-script.txt"))
+	assert.Error(t, err)
+}
+
+// TestInputScript_ForFrame asserts that frames without input have no buttons.
+func TestInputScript_ForFrame(t *testing.T) {
+	script := inputScript{5: {Pressed: []gb.Button{gb.ButtonA}}}
+	assert.Equal(t, []gb.Button{gb.ButtonA}, script.forFrame(5).Pressed)
+	assert.Equal(t, gb.ButtonInput{}, script.forFrame(6))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"io/ioutil"
 	"log"
 	"os"
 	"runtime/pprof"
@@ -12,6 +13,7 @@ import (
 
 	"fmt"
 
+	"github.com/Humpheh/goboy/pkg/apu/otosink"
 	"github.com/Humpheh/goboy/pkg/gb"
 	"github.com/Humpheh/goboy/pkg/gb/io"
 	"github.com/faiface/pixel/pixelgl"
@@ -20,6 +22,9 @@ import (
 // The version of GoBoy
 var version = "develop"
 
+// The number of frames between each snapshot in the rewind buffer.
+const rewindInterval = 2
+
 const logo = `
     ______      ____
    / ____/___  / __ )____  __  __
@@ -32,11 +37,19 @@ const logo = `
 var (
 	mute    = flag.Bool("mute", false, "mute sound output")
 	dmgMode = flag.Bool("dmg", false, "set to force dmg mode")
+	model   = flag.String("model", "", "hardware model to emulate: dmg0, dmg, mgb, sgb, sgb2, cgb or agb")
+	rewind  = flag.Int("rewind", 32, "megabytes of memory to use for rewinding, 0 to disable")
+	saveDir = flag.String("savedir", "", "directory to store save files in (defaults to next to the rom)")
+	bootROM = flag.String("bootrom", "", "dmg or cgb boot rom to run before the game")
+	oamBug  = flag.Bool("oambug", false, "emulate the dmg oam corruption bug")
+	record  = flag.String("record", "", "wav file to record the audio to (press C to start or stop recording)")
+	stems   = flag.Bool("stems", false, "also record each sound channel to a separate wav file")
 
 	cpuprofile  = flag.String("cpuprofile", "", "write cpu profile to file (debugging)")
 	vsyncOff    = flag.Bool("disableVsync", false, "set to disable vsync (debugging)")
 	stepThrough = flag.Bool("stepthrough", false, "step through opcodes (debugging)")
 	unlocked    = flag.Bool("unlocked", false, "if to unlock the cpu speed (debugging)")
+	unrestrict  = flag.Bool("unrestricted", false, "allow access to vram and oam in any ppu mode (debugging)")
 )
 
 func main() {
@@ -68,7 +81,48 @@ func start() {
 		opts = append(opts, gb.WithCGBEnabled())
 	}
 	if !*mute {
-		opts = append(opts, gb.WithSound())
+		sink, err := otosink.New()
+		if err != nil {
+			log.Fatalf("Failed to start audio: %v", err)
+		}
+		defer func() {
+			if err := sink.Close(); err != nil {
+				log.Printf("Failed to close audio: %v", err)
+			}
+		}()
+		opts = append(opts, gb.WithAudioSink(sink))
+	}
+	if *model != "" {
+		m, err := gb.ParseModel(*model)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, gb.WithModel(m))
+	}
+	if *saveDir != "" {
+		opts = append(opts, gb.WithSaveDirectory(*saveDir))
+	}
+	if *rewind > 0 {
+		opts = append(opts, gb.WithRewind(rewindInterval, *rewind<<20))
+	}
+	if *bootROM != "" {
+		data, err := ioutil.ReadFile(*bootROM)
+		if err != nil {
+			log.Fatalf("Failed to load boot rom: %v", err)
+		}
+		opts = append(opts, gb.WithBootROM(data))
+	}
+	if *oamBug {
+		opts = append(opts, gb.WithOAMBug())
+	}
+	if *unrestrict {
+		opts = append(opts, gb.WithUnrestrictedAccess())
+	}
+	if *record != "" {
+		opts = append(opts, gb.WithRecording(*record))
+	}
+	if *stems {
+		opts = append(opts, gb.WithRecordingStems())
 	}
 
 	// Initialise the GameBoy with the flag options
@@ -84,10 +138,17 @@ func start() {
 	enableVSync := !(*vsyncOff || *unlocked)
 	monitor := io.NewPixelsIOBinding(enableVSync, gameboy)
 	startGBLoop(gameboy, monitor)
+
+	if err := gameboy.Flush(); err != nil {
+		log.Printf("Failed to save game: %v", err)
+	}
+	if err := gameboy.StopRecording(); err != nil {
+		log.Printf("Failed to finish recording: %v", err)
+	}
 }
 
 func startGBLoop(gameboy *gb.Gameboy, monitor gb.IOBinding) {
-	frameTime := time.Second / gb.FramesSecond
+	frameTime := time.Second * gb.CyclesFrame / gb.ClockSpeed
 	if *unlocked {
 		frameTime = 1
 	}
@@ -2,21 +2,15 @@ package apu
 
 import (
 	"fmt"
-	"math"
-	"time"
-
 	"log"
-
-	"github.com/hajimehoshi/oto"
+	"math"
 )
 
 const (
-	sampleRate = 44100
-	twoPi      = 2 * math.Pi
-	perSample  = 1 / float64(sampleRate)
+	cpuTicksPerSample = float64(4194304) / SampleRate
 
-	cpuTicksPerSample    = float64(4194304) / sampleRate
-	maxFrameBufferLength = 5000
+	// Number of frames which are collected before they are pushed to the sink
+	sinkChunkLength = 512
 )
 
 // APU is the GameBoy's audio processing unit. Audio comprises four
@@ -24,170 +18,297 @@ const (
 //
 // Channels 1 and 2 are both Square channels, channel 3 is a arbitrary
 // waveform channel which can be set in RAM, and channel 4 outputs noise.
+//
+// The channels are clocked by the CPU cycles passed to Buffer, and their
+// length counters, envelopes and sweep are clocked by the frame sequencer
+// which is stepped by the DIV register at 512 Hz. The mixed output is pushed
+// to an AudioSink.
 type APU struct {
-	playing bool
-
-	memory      [52]byte
-	waveformRam []byte
-
-	player                 *oto.Player
-	chn1, chn2, chn3, chn4 *Channel
-	tickCounter            float64
-	lVol, rVol             float64
-
-	audioBuffer chan [2]byte
+	cgb bool
+
+	// Set while the APU is powered on by NR52
+	enabled bool
+	memory  [0x30]byte
+
+	chn1, chn2 *squareChannel
+	chn3       *waveChannel
+	chn4       *noiseChannel
+
+	// Step of the frame sequencer which will be run next
+	sequencerStep int
+	tickCounter   float64
+
+	// High-pass filter of the output, and the charge its capacitor keeps
+	// between each sample
+	filter highPassFilter
+	charge float64
+
+	// Sink the audio is output to, and the frames waiting to be pushed to it
+	sink   AudioSink
+	frames []Frame
+	// Recording of the output, nil if it is not being recorded
+	recording *recording
 }
 
-// Init the sound emulation for a Gameboy.
-func (a *APU) Init(sound bool) {
-	a.playing = sound
-	a.waveformRam = make([]byte, 0x20)
-	a.audioBuffer = make(chan [2]byte, maxFrameBufferLength)
+// Init the sound emulation for a Gameboy. The audio is output to the sink, or
+// is not generated if the sink is nil. The CGB flag selects the behaviour of
+// the CGB APU, which differs from the DMG when it is powered off and when
+// accessing the wave RAM.
+func (a *APU) Init(sink AudioSink, cgb bool) {
+	a.sink = sink
+	a.cgb = cgb
+	a.charge = math.Pow(dmgCapacitorCharge, cpuTicksPerSample)
+	if cgb {
+		a.charge = math.Pow(cgbCapacitorCharge, cpuTicksPerSample)
+	}
+	a.frames = make([]Frame, 0, sinkChunkLength)
+
+	// Create the channels with their sounds
+	a.chn1 = &squareChannel{}
+	a.chn2 = &squareChannel{}
+	a.chn3 = &waveChannel{}
+	a.chn4 = &noiseChannel{}
 
 	// Sets waveform ram to:
 	// 00 FF 00 FF  00 FF 00 FF  00 FF 00 FF  00 FF 00 FF
-	for x := 0x0; x < 0x20; x++ {
-		if x&2 == 0 {
-			a.waveformRam[x] = 0x00
-		} else {
-			a.waveformRam[x] = 0xFF
+	for x := range a.chn3.RAM {
+		if x%2 == 1 {
+			a.chn3.RAM[x] = 0xFF
 		}
 	}
+}
 
-	// Create the channels with their sounds
-	a.chn1 = NewChannel()
-	a.chn2 = NewChannel()
-	a.chn3 = NewChannel()
-	a.chn4 = NewChannel()
-
-	const bufferSeconds = 120
-
-	if sound {
-		var err error
-		a.player, err = oto.NewPlayer(sampleRate, 2, 1, sampleRate/bufferSeconds)
-		if err != nil {
-			log.Fatalf("Failed to start audio: %v", err)
-		}
-		a.playSound(bufferSeconds)
+// Buffer advances the channels by a number of CPU cycles and outputs a frame
+// each time enough cycles have passed for the sample rate. In double speed
+// mode the CPU cycles are half the length.
+func (a *APU) Buffer(cpuTicks int, speed int) {
+	cycles := cpuTicks / speed
+	if a.enabled {
+		a.chn1.step(cycles)
+		a.chn2.step(cycles)
+		a.chn3.step(cycles)
+		a.chn4.step(cycles)
 	}
-}
 
-// Starts a goroutine which plays the sound
-func (a *APU) playSound(bufferSeconds int) {
-	frameTime := time.Second / time.Duration(bufferSeconds)
-	ticker := time.NewTicker(frameTime)
-	targetSamples := sampleRate / bufferSeconds
-	go func() {
-		var reading [2]byte
-		var buffer []byte
-		for range ticker.C {
-			fbLen := len(a.audioBuffer)
-			if fbLen >= targetSamples/2 {
-				newBuffer := make([]byte, fbLen*2)
-				for i := 0; i < fbLen*2; i += 2 {
-					reading = <-a.audioBuffer
-					newBuffer[i], newBuffer[i+1] = reading[0], reading[1]
-				}
-				buffer = newBuffer
-			}
+	a.tickCounter += float64(cycles)
+	if a.tickCounter < cpuTicksPerSample {
+		return
+	}
+	a.tickCounter -= cpuTicksPerSample
+	if a.sink == nil && a.recording == nil {
+		return
+	}
 
-			_, err := a.player.Write(buffer)
-			if err != nil {
-				log.Printf("error sampling: %v", err)
+	analog := a.dacOutputs()
+	frame := a.mix(analog, 0xF, &a.filter)
+	if a.sink != nil {
+		a.frames = append(a.frames, frame)
+		if len(a.frames) >= sinkChunkLength {
+			a.Flush()
+		}
+	}
+	if a.recording != nil {
+		var stems [4]Frame
+		if a.recording.hasStems() {
+			for i := range stems {
+				stems[i] = a.mix(analog, 1<<uint(i), &a.recording.filters[i])
 			}
 		}
-	}()
+		if err := a.recording.add(frame, stems); err != nil {
+			a.abortRecording(err)
+		}
+	}
 }
 
-func (a *APU) Buffer(cpuTicks int, speed int) {
-	if !a.playing {
-		return
+// Flush pushes the frames which have been generated to the sink, and writes
+// the frames which have been recorded.
+func (a *APU) Flush() {
+	if a.recording != nil {
+		if err := a.recording.flush(); err != nil {
+			a.abortRecording(err)
+		}
 	}
-	a.tickCounter += float64(cpuTicks) / float64(speed)
-	if a.tickCounter < cpuTicksPerSample {
+	if a.sink == nil || len(a.frames) == 0 {
 		return
 	}
-	a.tickCounter -= cpuTicksPerSample
+	if err := a.sink.WriteFrames(a.frames); err != nil {
+		log.Printf("error writing audio: %v", err)
+	}
+	a.frames = a.frames[:0]
+}
+
+// StartRecording records the mixed output of the APU to a WAV file. If stems
+// is set each of the channels is also recorded to a separate file, named by
+// StemPath. Any current recording is stopped first.
+func (a *APU) StartRecording(path string, stems bool) error {
+	if err := a.StopRecording(); err != nil {
+		return err
+	}
+	rec, err := newRecording(path, stems)
+	if err != nil {
+		return err
+	}
 
-	chn1l, chn1r := a.chn1.Sample()
-	chn2l, chn2r := a.chn2.Sample()
-	chn3l, chn3r := a.chn3.Sample()
-	chn4l, chn4r := a.chn4.Sample()
+	// Charge the filters which have not been running as if they had been, so
+	// that the recording does not start with a click
+	analog := a.dacOutputs()
+	if a.sink == nil {
+		left, right, _ := a.pan(analog, 0xF)
+		a.filter.Capacitor = [2]float64{left, right}
+	}
+	for i := range rec.filters {
+		left, right, _ := a.pan(analog, 1<<uint(i))
+		rec.filters[i].Capacitor = [2]float64{left, right}
+	}
+	a.recording = rec
+	return nil
+}
 
-	valL := (chn1l + chn2l + chn3l + chn4l) / 4
-	valR := (chn1r + chn2r + chn3r + chn4r) / 4
+// StopRecording finishes writing the WAV files of the current recording.
+func (a *APU) StopRecording() error {
+	if a.recording == nil {
+		return nil
+	}
+	err := a.recording.close()
+	a.recording = nil
+	return err
+}
 
-	a.audioBuffer <- [2]byte{byte(float64(valL) * a.lVol), byte(float64(valR) * a.rVol)}
+// Stop the current recording after it has failed to write, so that the error
+// is only reported once. The frames which could not be written are dropped,
+// and the files are closed but may not be complete.
+func (a *APU) abortRecording(err error) {
+	log.Printf("error recording audio, stopping recording: %v", err)
+	for i := range a.recording.frames {
+		a.recording.frames[i] = nil
+	}
+	_ = a.recording.close()
+	a.recording = nil
 }
 
-var soundMask = []byte{
-	/* 0xFF10 */ 0xFF, 0xC0, 0xFF, 0x00, 0x40,
-	/* 0xFF15 */ 0x00, 0xC0, 0xFF, 0x00, 0x40,
-	/* 0xFF1A */ 0x80, 0x00, 0x60, 0x00, 0x40,
-	/* 0xFF20 */ 0x00, 0x3F, 0xFF, 0xFF, 0x40,
-	/* 0xFF24 */ 0xFF, 0xFF, 0x80,
+// IsRecording returns if the output of the APU is being recorded.
+func (a *APU) IsRecording() bool {
+	return a.recording != nil
 }
 
-var channel3Volume = map[byte]float64{0: 0, 1: 1, 2: 0.5, 3: 0.25}
+// Get the current output of each of the channels, between 0 and 15.
+func (a *APU) outputs() [4]byte {
+	return [4]byte{a.chn1.output(), a.chn2.output(), a.chn3.output(), a.chn4.output()}
+}
 
-var squareLimits = map[byte]float64{
-	0: -0.25, // 12.5% ( _-------_-------_------- )
-	1: -0.5,  // 25%   ( __------__------__------ )
-	2: 0,     // 50%   ( ____----____----____---- ) (normal)
-	3: 0.5,   // 75%   ( ______--______--______-- )
+// StepFrameSequencer runs the next step of the frame sequencer. This is called
+// on the falling edge of bit 4 of the DIV register, or bit 5 in double speed
+// mode, so happens at 512 Hz. The length counters are clocked every other step,
+// the sweep every fourth step and the envelopes every eighth step.
+func (a *APU) StepFrameSequencer() {
+	if !a.enabled {
+		return
+	}
+	switch a.sequencerStep {
+	case 0, 4:
+		a.clockLengths()
+	case 2, 6:
+		a.clockLengths()
+		a.chn1.clockSweep()
+	case 7:
+		a.chn1.Envelope.clock()
+		a.chn2.Envelope.clock()
+		a.chn4.Envelope.clock()
+	}
+	a.sequencerStep = (a.sequencerStep + 1) % 8
+}
+
+// Clock the length counters of all of the channels.
+func (a *APU) clockLengths() {
+	a.chn1.clockLength()
+	a.chn2.clockLength()
+	a.chn3.clockLength()
+	a.chn4.clockLength()
+}
+
+// Check if the next step of the frame sequencer will clock the length
+// counters.
+func (a *APU) lengthStep() bool {
+	return a.sequencerStep%2 == 0
+}
+
+// Bits which are always set when reading each of the registers.
+var readMask = []byte{
+	/* 0xFF10 */ 0x80, 0x3F, 0x00, 0xFF, 0xBF,
+	/* 0xFF15 */ 0xFF, 0x3F, 0x00, 0xFF, 0xBF,
+	/* 0xFF1A */ 0x7F, 0xFF, 0x9F, 0xFF, 0xBF,
+	/* 0xFF1F */ 0xFF, 0xFF, 0x00, 0x00, 0xBF,
+	/* 0xFF24 */ 0x00, 0x00, 0x70,
 }
 
 // Read returns a value from the APU.
 func (a *APU) Read(address uint16) byte {
-	if address >= 0xFF30 {
-		return a.waveformRam[address-0xFF30]
+	switch {
+	case address >= 0xFF30:
+		return a.readWaveform(address)
+	case address == 0xFF26:
+		var status byte
+		for i, chn := range a.channels() {
+			if chn.Enabled {
+				status |= 1 << uint(i)
+			}
+		}
+		if a.enabled {
+			status |= 0x80
+		}
+		return status | readMask[0x16]
+	case address > 0xFF26:
+		return 0xFF
 	}
-	// TODO: we should modify the sound memory as we're sampling
-	return a.memory[address-0xFF00] & soundMask[address-0xFF10]
+	return a.memory[address-0xFF00] | readMask[address-0xFF10]
 }
 
 // Write a value to the APU registers.
 func (a *APU) Write(address uint16, value byte) {
+	if address == 0xFF26 {
+		a.setPower(value&0x80 != 0)
+		return
+	}
+	if address > 0xFF26 {
+		return
+	}
+	if !a.enabled {
+		// The registers cannot be written while the APU is off, except for
+		// the length counters on the DMG
+		if a.cgb {
+			return
+		}
+		switch address {
+		case 0xFF11, 0xFF16, 0xFF20:
+			value &= 0x3F
+		case 0xFF1B:
+		default:
+			return
+		}
+	}
 	a.memory[address-0xFF00] = value
 
 	switch address {
 	// Channel 1
 	case 0xFF10:
 		// -PPP NSSS Sweep period, negate, shift
-		a.chn1.sweepStepLen = (a.memory[0x10] & 0b111_0000) >> 4
-		a.chn1.sweepSteps = a.memory[0x10] & 0b111
-		a.chn1.sweepIncrease = a.memory[0x10]&0b1000 == 0 // 1 = decrease
+		a.chn1.writeSweep(value)
 	case 0xFF11:
-		// DDLL LLLL Duty, Length load
-		duty := (value & 0b1100_0000) >> 6
-		a.chn1.generator = Square(squareLimits[duty])
-		a.chn1.length = int(value & 0b0011_1111)
+		// DDLL LLLL Duty, Length load (64-L)
+		a.chn1.Duty = value >> 6
+		a.chn1.Length = 64 - int(value&0x3F)
 	case 0xFF12:
-		// VVVV APPP - Starting volume, Envelop add mode, period
-		envVolume, envDirection, envSweep := a.extractEnvelope(value)
-		a.chn1.envelopeVolume = int(envVolume)
-		a.chn1.envelopeSamples = int(envSweep) * sampleRate / 64
-		a.chn1.envelopeIncreasing = envDirection == 1
+		// VVVV APPP Starting volume, Envelope add mode, period
+		a.chn1.Envelope.write(value)
+		a.chn1.setDAC(value&0xF8 != 0)
 	case 0xFF13:
 		// FFFF FFFF Frequency LSB
-		frequencyValue := uint16(a.memory[0x14]&0b111)<<8 | uint16(value)
-		a.chn1.frequency = 131072 / (2048 - float64(frequencyValue))
+		a.chn1.Frequency = a.chn1.Frequency&0x700 | uint16(value)
 	case 0xFF14:
-		// TL-- -FFF Trigger, Length Enable, Frequencu MSB
-		frequencyValue := uint16(value&0b111)<<8 | uint16(a.memory[0x13])
-		a.chn1.frequency = 131072 / (2048 - float64(frequencyValue))
-		if value&0b1000_0000 != 0 {
-			if a.chn1.length == 0 {
-				a.chn1.length = 64
-			}
-			duration := -1
-			if value&0b100_0000 != 0 { // 1 = use length
-				duration = int(float64(a.chn1.length)*(1/64)) * sampleRate
-			}
-			a.chn1.Reset(duration)
-			a.chn1.envelopeSteps = a.chn1.envelopeVolume
-			a.chn1.envelopeStepsInit = a.chn1.envelopeVolume
-			// TODO: Square 1's sweep does several things (see frequency sweep).
+		// TL-- -FFF Trigger, Length enable, Frequency MSB
+		a.chn1.Frequency = uint16(value&0x7)<<8 | a.chn1.Frequency&0xFF
+		if a.chn1.writeControl(value, 64, a.lengthStep()) {
+			a.chn1.trigger()
 		}
 
 	// Channel 2
@@ -195,125 +316,125 @@ func (a *APU) Write(address uint16, value byte) {
 		// ---- ---- Not used
 	case 0xFF16:
 		// DDLL LLLL Duty, Length load (64-L)
-		pattern := (value & 0b1100_0000) >> 6
-		a.chn2.generator = Square(squareLimits[pattern])
-		a.chn2.length = int(value & 0b11_1111)
+		a.chn2.Duty = value >> 6
+		a.chn2.Length = 64 - int(value&0x3F)
 	case 0xFF17:
 		// VVVV APPP Starting volume, Envelope add mode, period
-		envVolume, envDirection, envSweep := a.extractEnvelope(value)
-		a.chn2.envelopeVolume = int(envVolume)
-		a.chn2.envelopeSamples = int(envSweep) * sampleRate / 64
-		a.chn2.envelopeIncreasing = envDirection == 1
+		a.chn2.Envelope.write(value)
+		a.chn2.setDAC(value&0xF8 != 0)
 	case 0xFF18:
 		// FFFF FFFF Frequency LSB
-		frequencyValue := uint16(a.memory[0x19]&0b111)<<8 | uint16(value)
-		a.chn2.frequency = 131072 / (2048 - float64(frequencyValue))
+		a.chn2.Frequency = a.chn2.Frequency&0x700 | uint16(value)
 	case 0xFF19:
 		// TL-- -FFF Trigger, Length enable, Frequency MSB
-		if value&0b1000_0000 != 0 {
-			if a.chn2.length == 0 {
-				a.chn2.length = 64
-			}
-			duration := -1
-			if value&0b100_0000 != 0 {
-				duration = int(float64(a.chn2.length)*(1/64)) * sampleRate
-			}
-			a.chn2.Reset(duration)
-			a.chn2.envelopeSteps = a.chn2.envelopeVolume
-			a.chn2.envelopeStepsInit = a.chn2.envelopeVolume
+		a.chn2.Frequency = uint16(value&0x7)<<8 | a.chn2.Frequency&0xFF
+		if a.chn2.writeControl(value, 64, a.lengthStep()) {
+			a.chn2.trigger()
 		}
-		frequencyValue := uint16(value&0b111)<<8 | uint16(a.memory[0x18])
-		a.chn2.frequency = 131072 / (2048 - float64(frequencyValue))
 
 	// Channel 3
 	case 0xFF1A:
 		// E--- ---- DAC power
-		a.chn3.envelopeStepsInit = int((value & 0b1000_0000) >> 7)
+		a.chn3.setDAC(value&0x80 != 0)
 	case 0xFF1B:
-		// LLLL LLLL Length load
-		a.chn3.length = int(value)
+		// LLLL LLLL Length load (256-L)
+		a.chn3.Length = 256 - int(value)
 	case 0xFF1C:
 		// -VV- ---- Volume code
-		selection := (value & 0b110_0000) >> 5
-		a.chn3.amplitude = channel3Volume[selection]
+		a.chn3.VolumeCode = (value >> 5) & 0x3
 	case 0xFF1D:
 		// FFFF FFFF Frequency LSB
-		frequencyValue := uint16(a.memory[0x1E]&0b111)<<8 | uint16(value)
-		a.chn3.frequency = 65536 / (2048 - float64(frequencyValue))
+		a.chn3.Frequency = a.chn3.Frequency&0x700 | uint16(value)
 	case 0xFF1E:
 		// TL-- -FFF Trigger, Length enable, Frequency MSB
-		if value&0b1000_0000 != 0 {
-			if a.chn3.length == 0 {
-				a.chn3.length = 256
-			}
-			duration := -1
-			if value&0b100_0000 != 0 { // 1 = use length
-				duration = int((256-float64(a.chn3.length))*(1/256)) * sampleRate
-			}
-			a.chn3.generator = Waveform(func(i int) byte { return a.waveformRam[i] })
-			a.chn3.duration = duration
+		a.chn3.Frequency = uint16(value&0x7)<<8 | a.chn3.Frequency&0xFF
+		if !a.cgb && value&0x80 != 0 && a.chn3.Enabled {
+			a.chn3.corruptRAM()
+		}
+		if a.chn3.writeControl(value, 256, a.lengthStep()) {
+			a.chn3.trigger()
 		}
-		frequencyValue := uint16(value&0b111)<<8 | uint16(a.memory[0x1D])
-		a.chn3.frequency = 65536 / (2048 - float64(frequencyValue))
 
 	// Channel 4
 	case 0xFF1F:
 		// ---- ---- Not used
 	case 0xFF20:
-		// --LL LLLL Length load
-		a.chn4.length = int(value & 0b11_1111)
+		// --LL LLLL Length load (64-L)
+		a.chn4.Length = 64 - int(value&0x3F)
 	case 0xFF21:
 		// VVVV APPP Starting volume, Envelope add mode, period
-		envVolume, envDirection, envSweep := a.extractEnvelope(value)
-		a.chn4.envelopeVolume = int(envVolume)
-		a.chn4.envelopeSamples = int(envSweep) * sampleRate / 64
-		a.chn4.envelopeIncreasing = envDirection == 1
+		a.chn4.Envelope.write(value)
+		a.chn4.setDAC(value&0xF8 != 0)
 	case 0xFF22:
 		// SSSS WDDD Clock shift, Width mode of LFSR, Divisor code
-		shiftClock := float64((value & 0b1111_0000) >> 4)
-		// TODO: counter step width
-		divRatio := float64(value & 0b111)
-		if divRatio == 0 {
-			divRatio = 0.5
-		}
-		a.chn4.frequency = 524288 / divRatio / math.Pow(2, shiftClock+1)
+		a.chn4.writePolynomial(value)
 	case 0xFF23:
 		// TL-- ---- Trigger, Length enable
-		if value&0x80 == 0x80 {
-			duration := -1
-			if value&0b100_0000 != 0 { // 1 = use length
-				duration = int(float64(61-a.chn4.length)*(1/256)) * sampleRate
-			}
-			a.chn4.generator = Noise()
-			a.chn4.Reset(duration)
-			a.chn4.envelopeSteps = a.chn4.envelopeVolume
-			a.chn4.envelopeStepsInit = a.chn4.envelopeVolume
+		if a.chn4.writeControl(value, 64, a.lengthStep()) {
+			a.chn4.trigger()
 		}
+	}
+}
+
+// Turn the APU on or off with NR52. Turning the APU off clears all of the
+// registers, and turning it on resets the frame sequencer.
+func (a *APU) setPower(on bool) {
+	if on == a.enabled {
+		return
+	}
+	if on {
+		a.enabled = true
+		a.sequencerStep = 0
+		return
+	}
 
-	case 0xFF24:
-		// Volume control
-		a.lVol = float64((a.memory[0x24]&0x70)>>4) / 7
-		a.rVol = float64(a.memory[0x24]&0x7) / 7
-
-	case 0xFF25:
-		// Channel control
-		a.chn1.onR = value&0x1 != 0
-		a.chn2.onR = value&0x2 != 0
-		a.chn3.onR = value&0x4 != 0
-		a.chn4.onR = value&0x8 != 0
-		a.chn1.onL = value&0x10 != 0
-		a.chn2.onL = value&0x20 != 0
-		a.chn3.onL = value&0x40 != 0
-		a.chn4.onL = value&0x80 != 0
+	// The length counters are not affected on the DMG
+	var lengths [4]int
+	for i, chn := range a.channels() {
+		lengths[i] = chn.Length
+	}
+	a.memory = [0x30]byte{}
+	a.chn1 = &squareChannel{channel: channel{debugOff: a.chn1.debugOff}}
+	a.chn2 = &squareChannel{channel: channel{debugOff: a.chn2.debugOff}}
+	a.chn3 = &waveChannel{channel: channel{debugOff: a.chn3.debugOff}, RAM: a.chn3.RAM}
+	a.chn4 = &noiseChannel{channel: channel{debugOff: a.chn4.debugOff}}
+	if !a.cgb {
+		for i, chn := range a.channels() {
+			chn.Length = lengths[i]
+		}
 	}
-	// TODO: if writing to FF26 bit 7 destroy all contents (also cannot access)
+	a.enabled = false
 }
 
-// WriteWaveform writes a value to the waveform ram.
+// Get the shared state of each of the channels.
+func (a *APU) channels() [4]*channel {
+	return [4]*channel{&a.chn1.channel, &a.chn2.channel, &a.chn3.channel, &a.chn4.channel}
+}
+
+// Read from the wave RAM. While channel 3 is playing the CGB reads the byte
+// which the channel is playing, and the DMG can only read it in the cycle the
+// channel reads it.
+func (a *APU) readWaveform(address uint16) byte {
+	if a.chn3.Enabled {
+		if !a.cgb && !a.chn3.justRead() {
+			return 0xFF
+		}
+		return a.chn3.RAM[a.chn3.Position/2]
+	}
+	return a.chn3.RAM[address-0xFF30]
+}
+
+// WriteWaveform writes a value to the waveform ram. While channel 3 is playing
+// the write goes to the byte which the channel is playing, but on the DMG it
+// is ignored unless it is in the cycle the channel reads it.
 func (a *APU) WriteWaveform(address uint16, value byte) {
-	soundIndex := (address - 0xFF30) * 2
-	a.waveformRam[soundIndex] = (value >> 4) & 0xF * 0x11
-	a.waveformRam[soundIndex+1] = value & 0xF * 0x11
+	if a.chn3.Enabled {
+		if a.cgb || a.chn3.justRead() {
+			a.chn3.RAM[a.chn3.Position/2] = value
+		}
+		return
+	}
+	a.chn3.RAM[address-0xFF30] = value
 }
 
 // ToggleSoundChannel toggles a sound channel for debugging.
@@ -339,11 +460,3 @@ func (a *APU) LogSoundState() {
 	fmt.Printf("  0xFF1D FFFF FFFF = %08b\n", a.memory[0x1D])
 	fmt.Printf("  0xFF1E TL-- -FFF = %08b\n", a.memory[0x1E])
 }
-
-// Extract some envelope variables from a byte.
-func (a *APU) extractEnvelope(val byte) (volume, direction, sweep byte) {
-	volume = (val & 0xF0) >> 4
-	direction = (val & 0x8) >> 3 // 1 or 0
-	sweep = val & 0x7
-	return
-}
@@ -0,0 +1,266 @@
+package apu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Create an APU which has been powered on.
+func newAPU(cgb bool) *APU {
+	a := &APU{}
+	a.Init(nil, cgb)
+	a.Write(0xFF26, 0x80)
+	return a
+}
+
+// Check if a channel is playing using NR52.
+func playing(a *APU, channel int) bool {
+	return a.Read(0xFF26)&(1<<uint(channel-1)) != 0
+}
+
+// TestAPU_Registers asserts that the unused and write only bits of the
+// registers read as 1.
+func TestAPU_Registers(t *testing.T) {
+	a := newAPU(false)
+	for address := uint16(0xFF10); address < 0xFF26; address++ {
+		a.Write(address, 0)
+		assert.Equal(t, readMask[address-0xFF10], a.Read(address), "read 0 from %x", address)
+	}
+	assert.Equal(t, byte(0xFF), a.Read(0xFF27))
+	assert.Equal(t, byte(0xF0), a.Read(0xFF26))
+}
+
+// TestAPU_LengthCounter asserts that the length counter disables the channel
+// when it expires, and only counts down when it is enabled.
+func TestAPU_LengthCounter(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF12, 0xF0)
+	a.Write(0xFF11, 62)
+	a.Write(0xFF14, 0x80)
+	for i := 0; i < 8; i++ {
+		a.StepFrameSequencer()
+	}
+	assert.True(t, playing(a, 1), "length should not count down when disabled")
+
+	a.Write(0xFF14, 0x40)
+	a.StepFrameSequencer()
+	a.StepFrameSequencer()
+	assert.True(t, playing(a, 1))
+	a.StepFrameSequencer()
+	assert.False(t, playing(a, 1), "length should expire after 2 clocks")
+}
+
+// TestAPU_LengthEnableClock asserts that enabling the length counter when the
+// next step of the frame sequencer will not clock it clocks it straight away.
+func TestAPU_LengthEnableClock(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF12, 0xF0)
+	a.Write(0xFF11, 63)
+	a.Write(0xFF14, 0x80)
+	a.StepFrameSequencer()
+	a.Write(0xFF14, 0x40)
+	assert.False(t, playing(a, 1), "enabling length should clock it")
+
+	a.Write(0xFF14, 0xC0)
+	assert.True(t, playing(a, 1))
+	assert.Equal(t, 63, a.chn1.Length, "trigger should reload the length minus the extra clock")
+}
+
+// TestAPU_DAC asserts that a channel cannot play while its DAC is off.
+func TestAPU_DAC(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF17, 0x00)
+	a.Write(0xFF19, 0x80)
+	assert.False(t, playing(a, 2), "channel should not start with the dac off")
+
+	a.Write(0xFF17, 0x08)
+	a.Write(0xFF19, 0x80)
+	assert.True(t, playing(a, 2))
+	a.Write(0xFF17, 0x00)
+	assert.False(t, playing(a, 2), "turning off the dac should stop the channel")
+}
+
+// TestAPU_SweepOverflow asserts that the sweep disables channel 1 when the
+// calculated frequency overflows.
+func TestAPU_SweepOverflow(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF12, 0xF0)
+	a.Write(0xFF10, 0x11)
+	a.Write(0xFF13, 0xFF)
+	a.Write(0xFF14, 0x87)
+	assert.False(t, playing(a, 1), "overflow check on trigger should disable the channel")
+
+	a.Write(0xFF13, 0x00)
+	a.Write(0xFF14, 0x85)
+	assert.True(t, playing(a, 1))
+	for i := 0; i < 8 && playing(a, 1); i++ {
+		a.StepFrameSequencer()
+	}
+	assert.False(t, playing(a, 1), "sweep should overflow")
+	assert.Equal(t, uint16(0x780), a.chn1.Frequency, "sweep should update the frequency")
+}
+
+// TestAPU_SweepNegate asserts that clearing the negate bit after the sweep has
+// calculated a frequency in negate mode disables channel 1.
+func TestAPU_SweepNegate(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF12, 0xF0)
+	a.Write(0xFF10, 0x19)
+	a.Write(0xFF14, 0x84)
+	assert.True(t, playing(a, 1))
+	a.Write(0xFF10, 0x11)
+	assert.False(t, playing(a, 1))
+}
+
+// TestAPU_Envelope asserts that the envelope changes the volume every period
+// steps of 1/64 of a second.
+func TestAPU_Envelope(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF21, 0xA2)
+	a.Write(0xFF23, 0x80)
+	for i := 0; i < 16; i++ {
+		a.StepFrameSequencer()
+	}
+	assert.Equal(t, byte(9), a.chn4.Envelope.Volume)
+}
+
+// TestAPU_Power asserts that turning the APU off clears the registers and
+// ignores writes, apart from the length counters on the DMG.
+func TestAPU_Power(t *testing.T) {
+	for _, cgb := range []bool{false, true} {
+		a := newAPU(cgb)
+		a.Write(0xFF24, 0x77)
+		a.Write(0xFF26, 0x00)
+		assert.Equal(t, byte(0x00), a.Read(0xFF24), "registers should be cleared")
+		assert.Equal(t, byte(0x70), a.Read(0xFF26))
+
+		a.Write(0xFF24, 0x77)
+		a.Write(0xFF11, 0xFF)
+		assert.Equal(t, byte(0x00), a.Read(0xFF24), "writes should be ignored")
+		if cgb {
+			assert.Equal(t, 0, a.chn1.Length, "cgb length should be cleared")
+		} else {
+			assert.Equal(t, 1, a.chn1.Length, "dmg length should be written")
+			assert.Equal(t, byte(0x3F), a.Read(0xFF11), "dmg duty should not be written")
+		}
+	}
+}
+
+// TestAPU_Square asserts that the square channel steps through the duty
+// cycle at the frequency.
+func TestAPU_Square(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF16, 0x80)
+	a.Write(0xFF17, 0xF0)
+	a.Write(0xFF18, 0x00)
+	a.Write(0xFF19, 0x87)
+
+	var outputs []byte
+	for i := 0; i < 8; i++ {
+		a.Buffer(4*(2048-0x700), 1)
+		outputs = append(outputs, a.chn2.output())
+	}
+	assert.Equal(t, []byte{0, 0, 0, 0, 15, 15, 15, 15}, outputs)
+}
+
+// Get the output of the noise channel each time the LFSR is clocked.
+func noiseOutputs(a *APU, n int) []byte {
+	outputs := make([]byte, n)
+	for i := range outputs {
+		a.Buffer(a.chn4.period(), 1)
+		outputs[i] = a.chn4.output()
+	}
+	return outputs
+}
+
+// TestAPU_Noise asserts that the noise channel repeats every 32767 bits in the
+// 15-bit mode and every 127 bits in the 7-bit mode, and is deterministic.
+func TestAPU_Noise(t *testing.T) {
+	for _, test := range []struct {
+		nr43   byte
+		period int
+	}{{0x00, 32767}, {0x08, 127}} {
+		a := newAPU(false)
+		a.Write(0xFF21, 0xF0)
+		a.Write(0xFF22, test.nr43)
+		a.Write(0xFF23, 0x80)
+		outputs := noiseOutputs(a, test.period*2)
+		assert.Equal(t, outputs[:test.period], outputs[test.period:], "nr43 %02x", test.nr43)
+		assert.NotEqual(t, outputs[:test.period/2], outputs[test.period/2:test.period])
+
+		b := newAPU(false)
+		b.Write(0xFF21, 0xF0)
+		b.Write(0xFF22, test.nr43)
+		b.Write(0xFF23, 0x80)
+		assert.Equal(t, outputs, noiseOutputs(b, test.period*2), "noise should be deterministic")
+	}
+}
+
+// TestAPU_NoiseClockShift asserts that the LFSR is not clocked with a clock
+// shift of 14 or 15.
+func TestAPU_NoiseClockShift(t *testing.T) {
+	a := newAPU(false)
+	a.Write(0xFF21, 0xF0)
+	a.Write(0xFF22, 0xE0)
+	a.Write(0xFF23, 0x80)
+	a.Buffer(a.chn4.period()*4, 1)
+	assert.Equal(t, uint16(0x7FFF), a.chn4.LFSR)
+}
+
+// Create an APU which is playing channel 3 with a period of 512 cycles and
+// the wave RAM set to 0x00, 0x11, ... 0xFF.
+func newWaveAPU(cgb bool) *APU {
+	a := newAPU(cgb)
+	for i := uint16(0); i < 16; i++ {
+		a.WriteWaveform(0xFF30+i, byte(i*0x11))
+	}
+	a.Write(0xFF1A, 0x80)
+	a.Write(0xFF1D, 0x00)
+	a.Write(0xFF1E, 0x87)
+	return a
+}
+
+// TestAPU_WaveRAMWhileOn asserts that while channel 3 is playing the wave RAM
+// accesses the byte being played, which on the DMG is only possible in the
+// cycle it is read by the channel.
+func TestAPU_WaveRAMWhileOn(t *testing.T) {
+	dmg := newWaveAPU(false)
+	assert.Equal(t, byte(0xFF), dmg.Read(0xFF35), "dmg read before the sample")
+	dmg.Buffer(512*3, 1)
+	assert.Equal(t, byte(0x11), dmg.Read(0xFF35), "dmg read with the sample")
+	dmg.WriteWaveform(0xFF35, 0xAB)
+	assert.Equal(t, byte(0xAB), dmg.chn3.RAM[1], "dmg write with the sample")
+	dmg.Buffer(4, 1)
+	assert.Equal(t, byte(0xFF), dmg.Read(0xFF35), "dmg read after the sample")
+	dmg.WriteWaveform(0xFF35, 0xCD)
+	assert.Equal(t, byte(0xAB), dmg.chn3.RAM[1], "dmg write after the sample")
+
+	cgb := newWaveAPU(true)
+	cgb.Buffer(512*3+4, 1)
+	assert.Equal(t, byte(0x11), cgb.Read(0xFF35), "cgb read")
+	cgb.WriteWaveform(0xFF35, 0xCD)
+	assert.Equal(t, byte(0xCD), cgb.chn3.RAM[1], "cgb write")
+}
+
+// TestAPU_WaveTriggerCorruption asserts that triggering channel 3 on the DMG
+// just before it reads a sample corrupts the start of the wave RAM.
+func TestAPU_WaveTriggerCorruption(t *testing.T) {
+	for _, test := range []struct {
+		cgb     bool
+		cycles  int
+		samples int
+		ram     []byte
+	}{
+		{false, 510, 9, []byte{0x44, 0x55, 0x66, 0x77, 0x44}},
+		{false, 510, 4, []byte{0x22, 0x11, 0x22, 0x33, 0x44}},
+		{false, 500, 9, []byte{0x00, 0x11, 0x22, 0x33, 0x44}},
+		{true, 510, 9, []byte{0x00, 0x11, 0x22, 0x33, 0x44}},
+	} {
+		a := newWaveAPU(test.cgb)
+		a.Buffer(512*test.samples, 1)
+		a.Buffer(test.cycles, 1)
+		a.Write(0xFF1E, 0x87)
+		assert.Equal(t, test.ram, a.chn3.RAM[:5], "cgb %v after %v samples and %v cycles", test.cgb, test.samples, test.cycles)
+	}
+}
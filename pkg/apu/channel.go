@@ -1,126 +1,109 @@
 package apu
 
-import "math"
+// Parts of the state of a sound channel which are shared by all of the
+// channels. The fields are exported so that the channels can be stored in a
+// save state.
+type channel struct {
+	// Set while the channel is playing. The channel is enabled when it is
+	// triggered and disabled when its length expires or its DAC is turned off.
+	Enabled bool
+	// Set if the DAC of the channel is powered.
+	DACEnabled bool
 
-// NewChannel returns a new sound channel using a sampling function.
-func NewChannel() *Channel {
-	return &Channel{}
-}
-
-// Channel represents one of four Gameboy sound channels.
-type Channel struct {
-	frequency float64
-	generator WaveGenerator
-	time      float64
-	amplitude float64
-
-	// Duration in samples
-	duration int
-	length   int
+	// Length counter which disables the channel when it reaches 0.
+	Length        int
+	LengthEnabled bool
 
-	envelopeVolume     int
-	envelopeTime       int
-	envelopeSteps      int
-	envelopeStepsInit  int
-	envelopeSamples    int
-	envelopeIncreasing bool
-
-	sweepTime     float64
-	sweepStepLen  byte
-	sweepSteps    byte
-	sweepStep     byte
-	sweepIncrease bool
-
-	onL bool
-	onR bool
 	// Debug flag to turn off sound output
 	debugOff bool
 }
 
-// Sample returns a single sample for streaming the sound output. Each sample
-// will increase the internal timer based on the global sample rate.
-func (chn *Channel) Sample() (outputL, outputR uint16) {
-	var output uint16
-	step := chn.frequency * twoPi / float64(sampleRate)
-	chn.time += step
-	if chn.shouldPlay() {
-		// Take the sample value from the generator
-		if !chn.debugOff {
-			output = uint16(float64(chn.generator(chn.time)) * chn.amplitude)
-		}
-		if chn.duration > 0 {
-			chn.duration--
+// Clock the length counter of the channel. This is done by the frame
+// sequencer at 256 Hz.
+func (chn *channel) clockLength() {
+	if chn.LengthEnabled && chn.Length > 0 {
+		chn.Length--
+		if chn.Length == 0 {
+			chn.Enabled = false
 		}
 	}
-	chn.updateEnvelope()
-	chn.updateSweep()
-	if chn.onL {
-		outputL = output
-	}
-	if chn.onR {
-		outputR = output
-	}
-	return
 }
 
-// Reset the channel to some default variables for the sweep, amplitude,
-// envelope and duration.
-func (chn *Channel) Reset(duration int) {
-	chn.amplitude = 1
-	chn.envelopeTime = 0
-	chn.sweepTime = 0
-	chn.sweepStep = 0
-	chn.duration = duration
+// Set the DAC power of the channel. Turning off the DAC disables the channel.
+func (chn *channel) setDAC(enabled bool) {
+	chn.DACEnabled = enabled
+	if !enabled {
+		chn.Enabled = false
+	}
 }
 
-// Returns if the channel should be playing or not.
-func (chn *Channel) shouldPlay() bool {
-	return (chn.duration == -1 || chn.duration > 0) &&
-		chn.generator != nil && chn.envelopeStepsInit > 0
-}
+// Write to the length enable and trigger bits of the NRx4 register of the
+// channel, and returns if the channel was triggered. The length counter is
+// clocked when it is enabled if the next step of the frame sequencer will not
+// clock it, and is reloaded with the maximum length when it is triggered at 0.
+func (chn *channel) writeControl(value byte, maxLength int, lengthStep bool) bool {
+	wasEnabled := chn.LengthEnabled
+	chn.LengthEnabled = value&0x40 != 0
+	if !wasEnabled && chn.LengthEnabled && !lengthStep && chn.Length > 0 {
+		chn.Length--
+		if chn.Length == 0 && value&0x80 == 0 {
+			chn.Enabled = false
+		}
+	}
 
-// Update the state of the channels envelope.
-func (chn *Channel) updateEnvelope() {
-	if chn.envelopeSamples > 0 {
-		chn.envelopeTime += 1
-		if chn.envelopeSteps > 0 && chn.envelopeTime >= chn.envelopeSamples {
-			chn.envelopeTime -= chn.envelopeSamples
-			chn.envelopeSteps--
-			if chn.envelopeSteps == 0 {
-				chn.amplitude = 0
-			} else if chn.envelopeIncreasing {
-				chn.amplitude = 1 - float64(chn.envelopeSteps)/float64(chn.envelopeStepsInit)
-			} else {
-				chn.amplitude = float64(chn.envelopeSteps) / float64(chn.envelopeStepsInit)
-			}
+	if value&0x80 == 0 {
+		return false
+	}
+	if chn.Length == 0 {
+		chn.Length = maxLength
+		if chn.LengthEnabled && !lengthStep {
+			chn.Length--
 		}
 	}
+	chn.Enabled = chn.DACEnabled
+	return true
 }
 
-var sweepTimes = map[byte]float64{
-	1: 7.8 / 1000,
-	2: 15.6 / 1000,
-	3: 23.4 / 1000,
-	4: 31.3 / 1000,
-	5: 39.1 / 1000,
-	6: 46.9 / 1000,
-	7: 54.7 / 1000,
+// Volume envelope of the square and noise channels.
+type envelope struct {
+	// Values written to the NRx2 register
+	Initial  byte
+	Increase bool
+	Period   byte
+
+	Volume byte
+	Timer  byte
 }
 
-// Update the state of the channels sweep.
-func (chn *Channel) updateSweep() {
-	if chn.sweepStep < chn.sweepSteps {
-		t := sweepTimes[chn.sweepStepLen]
-		chn.sweepTime += perSample
-		if chn.sweepTime > t {
-			chn.sweepTime -= t
-			chn.sweepStep += 1
+// Write to the NRx2 register of the channel.
+func (env *envelope) write(value byte) {
+	env.Initial = value >> 4
+	env.Increase = value&0x8 != 0
+	env.Period = value & 0x7
+}
 
-			if chn.sweepIncrease {
-				chn.frequency += chn.frequency / math.Pow(2, float64(chn.sweepStep))
-			} else {
-				chn.frequency -= chn.frequency / math.Pow(2, float64(chn.sweepStep))
-			}
-		}
+// Reset the volume and timer of the envelope when the channel is triggered.
+func (env *envelope) trigger() {
+	env.Volume = env.Initial
+	env.Timer = env.Period
+}
+
+// Clock the envelope, which is done by the frame sequencer at 64 Hz. The
+// volume is changed each time the timer reaches 0, unless the period is 0.
+func (env *envelope) clock() {
+	if env.Period == 0 {
+		return
+	}
+	if env.Timer > 0 {
+		env.Timer--
+	}
+	if env.Timer > 0 {
+		return
+	}
+	env.Timer = env.Period
+	if env.Increase && env.Volume < 15 {
+		env.Volume++
+	} else if !env.Increase && env.Volume > 0 {
+		env.Volume--
 	}
 }
@@ -0,0 +1,96 @@
+package apu
+
+import "math"
+
+const (
+	// Amount the high-pass filter capacitor keeps of its charge each CPU
+	// cycle on the DMG and the CGB. The capacitor of the CGB discharges faster.
+	dmgCapacitorCharge = 0.999958
+	cgbCapacitorCharge = 0.998943
+
+	// Amplitude of the output of a single channel at full volume. Each channel
+	// has a quarter of the range so that all four can be at full volume
+	// without clipping.
+	channelAmplitude = math.MaxInt16 / 4
+)
+
+// High-pass filter of the left and right outputs. The output of the console
+// passes through a capacitor which removes the DC offset of the DACs, so that
+// a channel which is silent or holding a constant value outputs nothing.
+type highPassFilter struct {
+	Capacitor [2]float64
+}
+
+// Filter a sample of one of the outputs. The capacitor only charges while one
+// of the DACs is powered, otherwise the output is silent.
+func (f *highPassFilter) filter(side int, in float64, charge float64, dacs bool) float64 {
+	if !dacs {
+		return 0
+	}
+	out := in - f.Capacitor[side]
+	f.Capacitor[side] = in - out*charge
+	return out
+}
+
+// Get the analog output of each of the channel DACs, between -1 and 1. The
+// DAC outputs 1 for a digital value of 0 and -1 for 15, and outputs 0 while it
+// is powered off.
+func (a *APU) dacOutputs() [4]float64 {
+	digital := a.outputs()
+	var analog [4]float64
+	for i, chn := range a.channels() {
+		if chn.DACEnabled && !chn.debugOff {
+			analog[i] = 1 - float64(digital[i])/7.5
+		}
+	}
+	return analog
+}
+
+// Mix the DAC outputs of a set of channels, which are selected by the bits of
+// a mask, into the left and right outputs, and returns if any of their DACs
+// are powered. NR51 selects which of the outputs each channel is sent to, and
+// NR50 sets the volume of each output between 1/8 and 1.
+//
+// NR50 can also mix in the VIN signal from the cartridge, but no cartridges
+// emulated output any audio on it so it is always silent.
+func (a *APU) pan(analog [4]float64, channels byte) (left, right float64, dacs bool) {
+	panning := a.memory[0x25]
+	for i, chn := range a.channels() {
+		if channels&(1<<uint(i)) == 0 {
+			continue
+		}
+		dacs = dacs || chn.DACEnabled
+		if panning&(0x10<<uint(i)) != 0 {
+			left += analog[i]
+		}
+		if panning&(0x1<<uint(i)) != 0 {
+			right += analog[i]
+		}
+	}
+	left *= float64((a.memory[0x24]>>4)&0x7+1) / 8
+	right *= float64(a.memory[0x24]&0x7+1) / 8
+	return left, right, dacs
+}
+
+// Mix a set of channels into a frame, passing the outputs through a high-pass
+// filter.
+func (a *APU) mix(analog [4]float64, channels byte, f *highPassFilter) Frame {
+	left, right, dacs := a.pan(analog, channels)
+	return Frame{
+		Left:  toSample(f.filter(0, left, a.charge, dacs)),
+		Right: toSample(f.filter(1, right, a.charge, dacs)),
+	}
+}
+
+// Convert a filtered output to a 16-bit sample, clipping it if the filter has
+// pushed it outside of the range.
+func toSample(value float64) int16 {
+	sample := math.Round(value * channelAmplitude)
+	if sample > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if sample < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(sample)
+}
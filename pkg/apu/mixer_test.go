@@ -0,0 +1,125 @@
+package apu
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Create a powered on APU which outputs to a memory sink, with channel 1 set
+// up at full volume with a 50% duty cycle but not triggered.
+func newMixerAPU(cgb bool, volume, panning byte) (*APU, *MemorySink) {
+	sink := &MemorySink{}
+	a := &APU{}
+	a.Init(sink, cgb)
+	a.Write(0xFF26, 0x80)
+	a.Write(0xFF24, volume)
+	a.Write(0xFF25, panning)
+	a.Write(0xFF11, 0x80)
+	a.Write(0xFF12, 0xF0)
+	return a, sink
+}
+
+// Run the APU for a number of samples and return the frames it output.
+func runSamples(a *APU, sink *MemorySink, samples int) []Frame {
+	sink.Frames = nil
+	for i := 0; i < int(float64(samples)*cpuTicksPerSample); i += 4 {
+		a.Buffer(4, 1)
+	}
+	a.Flush()
+	return sink.Frames
+}
+
+// Get the largest and smallest left samples of the frames.
+func peaks(frames []Frame) (int16, int16) {
+	var high, low int16
+	for _, frame := range frames {
+		if frame.Left > high {
+			high = frame.Left
+		}
+		if frame.Left < low {
+			low = frame.Left
+		}
+	}
+	return high, low
+}
+
+// TestMixer_DCOffset asserts that the high-pass filter removes the offset of
+// a DAC which is powered but not playing.
+func TestMixer_DCOffset(t *testing.T) {
+	a, sink := newMixerAPU(false, 0x77, 0x11)
+	frames := runSamples(a, sink, SampleRate/10)
+	assert.InDelta(t, channelAmplitude, frames[0].Left, 1000, "DAC should output its offset when powered")
+	assert.InDelta(t, 0, frames[len(frames)-1].Left, 16, "offset should be filtered out")
+	assert.Equal(t, frames[len(frames)-1].Left, frames[len(frames)-1].Right)
+}
+
+// TestMixer_SquareWave asserts that a square wave is output centred around 0.
+func TestMixer_SquareWave(t *testing.T) {
+	a, sink := newMixerAPU(false, 0x77, 0x11)
+	a.Write(0xFF14, 0x87)
+	runSamples(a, sink, SampleRate/10)
+
+	frames := runSamples(a, sink, SampleRate/10)
+	var sum float64
+	for _, frame := range frames {
+		sum += float64(frame.Left)
+	}
+	assert.InDelta(t, 0, sum/float64(len(frames)), 100, "output should have no DC offset")
+
+	high, low := peaks(frames)
+	assert.InDelta(t, channelAmplitude, high, 1000)
+	assert.InDelta(t, -channelAmplitude, low, 1000)
+}
+
+// TestMixer_Volume asserts that NR50 scales each output between 1/8 and 1.
+func TestMixer_Volume(t *testing.T) {
+	amplitude := func(volume byte) float64 {
+		a, sink := newMixerAPU(false, volume, 0x11)
+		a.Write(0xFF14, 0x87)
+		runSamples(a, sink, SampleRate/10)
+		high, low := peaks(runSamples(a, sink, SampleRate/10))
+		return float64(high) - float64(low)
+	}
+	full := amplitude(0x77)
+	assert.InDelta(t, full/2, amplitude(0x33), full/100)
+	assert.InDelta(t, full/8, amplitude(0x00), full/100, "volume 0 should not mute")
+}
+
+// TestMixer_Panning asserts that NR51 selects the outputs of each channel.
+func TestMixer_Panning(t *testing.T) {
+	a, sink := newMixerAPU(false, 0x77, 0x10)
+	a.Write(0xFF14, 0x87)
+	frames := runSamples(a, sink, SampleRate/10)
+
+	high, _ := peaks(frames)
+	assert.True(t, high > 0, "channel should be output on the left")
+	for _, frame := range frames {
+		assert.Equal(t, int16(0), frame.Right, "channel should not be output on the right")
+	}
+}
+
+// TestMixer_DACOff asserts that a channel outputs nothing while its DAC is off,
+// even when it has an envelope period.
+func TestMixer_DACOff(t *testing.T) {
+	a, sink := newMixerAPU(false, 0x77, 0xFF)
+	a.Write(0xFF12, 0x07)
+	a.Write(0xFF14, 0x87)
+	for _, frame := range runSamples(a, sink, SampleRate/10) {
+		assert.Equal(t, Frame{}, frame)
+	}
+}
+
+// TestMixer_CGBFilter asserts that the capacitor of the CGB discharges faster
+// than the DMG.
+func TestMixer_CGBFilter(t *testing.T) {
+	offset := func(cgb bool) float64 {
+		a, sink := newMixerAPU(cgb, 0x77, 0x11)
+		frames := runSamples(a, sink, 100)
+		return math.Abs(float64(frames[len(frames)-1].Left))
+	}
+	dmg, cgb := offset(false), offset(true)
+	assert.True(t, cgb < dmg/2, "cgb offset %v should decay faster than dmg %v", cgb, dmg)
+	assert.True(t, dmg > 0)
+}
@@ -0,0 +1,69 @@
+package apu
+
+// Divisors of the noise channel frequency for each of the divisor codes.
+var noiseDivisors = [8]int{8, 16, 32, 48, 64, 80, 96, 112}
+
+// Noise channel, used for channel 4.
+type noiseChannel struct {
+	channel
+	Envelope envelope
+
+	ClockShift byte
+	WidthMode  bool
+	Divisor    byte
+	Timer      int
+	// Linear feedback shift register which generates the noise
+	LFSR uint16
+}
+
+// Get the number of cycles between each new bit of noise.
+func (chn *noiseChannel) period() int {
+	return noiseDivisors[chn.Divisor] << chn.ClockShift
+}
+
+// Write to the NR43 register.
+func (chn *noiseChannel) writePolynomial(value byte) {
+	chn.ClockShift = value >> 4
+	chn.WidthMode = value&0x8 != 0
+	chn.Divisor = value & 0x7
+}
+
+// Advance the frequency timer of the channel by a number of cycles. The LFSR
+// is not clocked with a clock shift of 14 or 15.
+func (chn *noiseChannel) step(cycles int) {
+	chn.Timer -= cycles
+	for chn.Timer <= 0 {
+		chn.Timer += chn.period()
+		if chn.ClockShift < 14 {
+			chn.clockLFSR()
+		}
+	}
+}
+
+// Shift the LFSR right by one bit. The XOR of the two lowest bits is put into
+// bit 14, and also into bit 6 in the 7-bit width mode which makes the noise
+// repeat after 127 bits instead of 32767.
+func (chn *noiseChannel) clockLFSR() {
+	feedback := (chn.LFSR ^ chn.LFSR>>1) & 1
+	chn.LFSR = chn.LFSR>>1 | feedback<<14
+	if chn.WidthMode {
+		chn.LFSR = chn.LFSR&^(1<<6) | feedback<<6
+	}
+}
+
+// Get the current output of the channel, between 0 and 15. The output is high
+// when the lowest bit of the LFSR is 0.
+func (chn *noiseChannel) output() byte {
+	if !chn.Enabled || chn.debugOff {
+		return 0
+	}
+	return byte(^chn.LFSR&1) * chn.Envelope.Volume
+}
+
+// Restart the channel when it has been triggered, which sets all of the bits
+// of the LFSR.
+func (chn *noiseChannel) trigger() {
+	chn.Timer = chn.period()
+	chn.LFSR = 0x7FFF
+	chn.Envelope.trigger()
+}
@@ -0,0 +1,86 @@
+// Package otosink plays the audio of the APU through the sound card using oto.
+// It is kept separate from the apu package so that the emulator core does not
+// depend on oto and the system sound libraries it needs.
+package otosink
+
+import (
+	"log"
+	"sync"
+
+	"github.com/Humpheh/goboy/pkg/apu"
+	"github.com/hajimehoshi/oto"
+)
+
+// Number of chunks of audio which can be waiting to be played before new
+// audio is dropped.
+const queueLength = 8
+
+// Sink is an apu.AudioSink which plays the audio through the sound card. The
+// audio is played on a separate goroutine so that writing frames does not
+// block the emulation, and audio is dropped if the player falls behind.
+type Sink struct {
+	player *oto.Player
+	queue  chan []byte
+	done   chan struct{}
+
+	// Guards the queue from being written to after it has been closed
+	mutex  sync.Mutex
+	closed bool
+}
+
+// New starts an oto player and returns a sink which plays through it.
+func New() (*Sink, error) {
+	const bufferSeconds = 20
+	player, err := oto.NewPlayer(apu.SampleRate, 2, 2, apu.SampleRate*4/bufferSeconds)
+	if err != nil {
+		return nil, err
+	}
+	sink := &Sink{
+		player: player,
+		queue:  make(chan []byte, queueLength),
+		done:   make(chan struct{}),
+	}
+	go sink.play()
+	return sink, nil
+}
+
+// Play the queued audio until the sink is closed.
+func (s *Sink) play() {
+	defer close(s.done)
+	for data := range s.queue {
+		if _, err := s.player.Write(data); err != nil {
+			log.Printf("error sampling: %v", err)
+		}
+	}
+}
+
+// WriteFrames queues the frames to be played. Frames written after the sink
+// has been closed are ignored.
+func (s *Sink) WriteFrames(frames []apu.Frame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	select {
+	case s.queue <- apu.EncodeFrames(frames):
+	default:
+		// The player has fallen behind so the audio is dropped
+	}
+	return nil
+}
+
+// Close finishes playing the queued audio and closes the player.
+func (s *Sink) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mutex.Unlock()
+
+	<-s.done
+	return s.player.Close()
+}
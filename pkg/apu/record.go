@@ -0,0 +1,116 @@
+package apu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Recording of the audio output by the APU to WAV files. The mixed output is
+// always recorded, and each of the channels can also be recorded to a separate
+// stem file.
+type recording struct {
+	files []*os.File
+	sinks []*WAVSink
+	// Frames waiting to be written to each of the sinks
+	frames [][]Frame
+	// High-pass filters of each of the stems
+	filters [4]highPassFilter
+}
+
+// StemPath returns the path the stem of a channel is recorded to when
+// recording to a path. The channel number is added before the extension, so
+// the stem of channel 1 of "song.wav" is "song_chn1.wav".
+func StemPath(path string, channel int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_chn%d%s", strings.TrimSuffix(path, ext), channel, ext)
+}
+
+// Create the files of a recording. The files which were created are removed
+// if any of them cannot be set up.
+func newRecording(path string, stems bool) (*recording, error) {
+	paths := []string{path}
+	if stems {
+		for i := 1; i <= 4; i++ {
+			paths = append(paths, StemPath(path, i))
+		}
+	}
+
+	rec := &recording{}
+	for _, p := range paths {
+		file, err := os.Create(p)
+		if err != nil {
+			rec.remove()
+			return nil, err
+		}
+		rec.files = append(rec.files, file)
+
+		sink, err := NewWAVSink(file)
+		if err != nil {
+			rec.remove()
+			return nil, err
+		}
+		rec.sinks = append(rec.sinks, sink)
+		rec.frames = append(rec.frames, make([]Frame, 0, sinkChunkLength))
+	}
+	return rec, nil
+}
+
+// Check if the recording has a stem for each channel.
+func (rec *recording) hasStems() bool {
+	return len(rec.sinks) > 1
+}
+
+// Add a frame of the mixed output and of each of the stems, which are ignored
+// if they are not being recorded.
+func (rec *recording) add(mix Frame, stems [4]Frame) error {
+	rec.frames[0] = append(rec.frames[0], mix)
+	if rec.hasStems() {
+		for i, frame := range stems {
+			rec.frames[i+1] = append(rec.frames[i+1], frame)
+		}
+	}
+	if len(rec.frames[0]) >= sinkChunkLength {
+		return rec.flush()
+	}
+	return nil
+}
+
+// Write the waiting frames to the files.
+func (rec *recording) flush() error {
+	for i, sink := range rec.sinks {
+		if len(rec.frames[i]) == 0 {
+			continue
+		}
+		if err := sink.WriteFrames(rec.frames[i]); err != nil {
+			return err
+		}
+		rec.frames[i] = rec.frames[i][:0]
+	}
+	return nil
+}
+
+// Write the remaining frames and close the files, returning the first error.
+func (rec *recording) close() error {
+	err := rec.flush()
+	for _, sink := range rec.sinks {
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	for _, file := range rec.files {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Close and delete the files of a recording which could not be set up.
+func (rec *recording) remove() {
+	for _, file := range rec.files {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+}
@@ -0,0 +1,131 @@
+package apu
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStemPath asserts that the channel is added before the extension.
+func TestStemPath(t *testing.T) {
+	assert.Equal(t, "dir/song_chn1.wav", StemPath("dir/song.wav", 1))
+	assert.Equal(t, "song_chn4", StemPath("song", 4))
+}
+
+// TestRecording_Stems asserts that the mixed output and each of the channels
+// are recorded to separate WAV files.
+func TestRecording_Stems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goboy-record")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "song.wav")
+
+	a := newAPU(false)
+	require.NoError(t, a.StartRecording(path, true))
+	assert.True(t, a.IsRecording())
+
+	// Play a square wave on channel 1 only
+	a.Write(0xFF24, 0x77)
+	a.Write(0xFF25, 0x11)
+	a.Write(0xFF12, 0xF0)
+	a.Write(0xFF14, 0x87)
+	for i := 0; i < 4194304/10; i += 4 {
+		a.Buffer(4, 1)
+	}
+	require.NoError(t, a.StopRecording())
+	assert.False(t, a.IsRecording())
+
+	read := func(path string) []byte {
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.True(t, len(data) > wavHeaderSize, "%v should contain audio", path)
+		return data[wavHeaderSize:]
+	}
+	mix := read(path)
+	assert.InDelta(t, SampleRate/10*4, len(mix), 4)
+	assert.Equal(t, mix, read(StemPath(path, 1)), "channel 1 should be the whole mix")
+	for channel := 2; channel <= 4; channel++ {
+		assert.Equal(t, make([]byte, len(mix)), read(StemPath(path, channel)), "channel %v should be silent", channel)
+	}
+}
+
+// TestRecording_NoStems asserts that stems are only written when requested.
+func TestRecording_NoStems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goboy-record")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "song.wav")
+
+	a := newAPU(false)
+	require.NoError(t, a.StartRecording(path, false))
+	require.NoError(t, a.StopRecording())
+
+	assert.FileExists(t, path)
+	_, err = os.Stat(StemPath(path, 1))
+	assert.True(t, os.IsNotExist(err), "stem should not be written")
+}
+
+// Writer which fails every write.
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func (w *failingWriter) Seek(int64, int) (int64, error) {
+	return 0, nil
+}
+
+// TestRecording_WriteError asserts that the recording is stopped after it
+// fails to write, so that the error is only reported once.
+func TestRecording_WriteError(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	writer := &failingWriter{}
+	a := newAPU(false)
+	a.recording = &recording{
+		sinks:  []*WAVSink{{w: writer}},
+		frames: [][]Frame{nil},
+	}
+	for i := 0; i < 4194304/10; i += 4 {
+		a.Buffer(4, 1)
+	}
+	a.Flush()
+
+	assert.False(t, a.IsRecording(), "recording should stop after an error")
+	assert.Equal(t, 1, strings.Count(logs.String(), "error recording audio"))
+	assert.True(t, writer.writes <= 2, "should stop writing after an error")
+}
+
+// TestRecording_CreateError asserts that the files of a recording which could
+// not be started are removed.
+func TestRecording_CreateError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goboy-record")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "song.wav")
+
+	// The stem of channel 2 cannot be created over a directory
+	require.NoError(t, os.Mkdir(StemPath(path, 2), 0755))
+
+	a := newAPU(false)
+	assert.Error(t, a.StartRecording(path, true))
+	assert.False(t, a.IsRecording())
+	for _, p := range []string{path, StemPath(path, 1)} {
+		_, err := os.Stat(p)
+		assert.True(t, os.IsNotExist(err), "%v should be removed", p)
+	}
+}
@@ -0,0 +1,49 @@
+package apu
+
+import "encoding/binary"
+
+// SampleRate is the number of stereo frames per second output by the APU.
+const SampleRate = 44100
+
+// Frame is a single stereo sample output by the APU.
+type Frame struct {
+	Left, Right int16
+}
+
+// AudioSink receives the audio output by the APU. The APU pushes the frames
+// it has generated to the sink in order, at SampleRate frames per second of
+// emulated time. The slice of frames is reused by the APU after the call so
+// it must not be kept by the sink.
+type AudioSink interface {
+	WriteFrames(frames []Frame) error
+}
+
+// NullSink is an AudioSink which discards all of the audio.
+type NullSink struct{}
+
+// WriteFrames discards the frames.
+func (NullSink) WriteFrames([]Frame) error {
+	return nil
+}
+
+// MemorySink is an AudioSink which stores all of the audio in memory.
+type MemorySink struct {
+	Frames []Frame
+}
+
+// WriteFrames appends the frames to the stored frames.
+func (s *MemorySink) WriteFrames(frames []Frame) error {
+	s.Frames = append(s.Frames, frames...)
+	return nil
+}
+
+// EncodeFrames encodes frames as interleaved little endian 16-bit samples, the
+// format used by WAV files and most audio players.
+func EncodeFrames(frames []Frame) []byte {
+	data := make([]byte, len(frames)*4)
+	for i, frame := range frames {
+		binary.LittleEndian.PutUint16(data[i*4:], uint16(frame.Left))
+		binary.LittleEndian.PutUint16(data[i*4+2:], uint16(frame.Right))
+	}
+	return data
+}
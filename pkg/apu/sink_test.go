@@ -0,0 +1,103 @@
+package apu
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run the APU with a square wave on channel 1 output to a sink.
+func runSquare(sink AudioSink, cycles int) *APU {
+	a := &APU{}
+	a.Init(sink, false)
+	a.Write(0xFF26, 0x80)
+	a.Write(0xFF24, 0x77)
+	a.Write(0xFF25, 0x11)
+	a.Write(0xFF12, 0xF0)
+	a.Write(0xFF13, 0x00)
+	a.Write(0xFF14, 0x87)
+	for i := 0; i < cycles; i += 4 {
+		a.Buffer(4, 1)
+	}
+	a.Flush()
+	return a
+}
+
+// TestSink_Memory asserts that the APU pushes a frame to the sink for each
+// sample, and that the output is the same each time it is run.
+func TestSink_Memory(t *testing.T) {
+	first := &MemorySink{}
+	runSquare(first, 4194304/10)
+	assert.InDelta(t, SampleRate/10, len(first.Frames), 1)
+
+	var high bool
+	for _, frame := range first.Frames {
+		high = high || frame.Left != 0
+	}
+	assert.True(t, high, "square wave should be output")
+
+	second := &MemorySink{}
+	runSquare(second, 4194304/10)
+	assert.Equal(t, first.Frames, second.Frames)
+}
+
+// TestSink_Null asserts that no frames are kept when there is no sink.
+func TestSink_Null(t *testing.T) {
+	a := runSquare(nil, 4194304/10)
+	assert.Empty(t, a.frames)
+	runSquare(NullSink{}, 4194304/10)
+}
+
+// TestSink_WAV asserts that the WAV sink writes the frames after a header
+// with the size of the data.
+func TestSink_WAV(t *testing.T) {
+	file, err := ioutil.TempFile("", "goboy-wav")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	sink, err := NewWAVSink(file)
+	require.NoError(t, err)
+	frames := []Frame{{Left: 1, Right: -1}, {Left: 0x1234, Right: 0}}
+	require.NoError(t, sink.WriteFrames(frames))
+	require.NoError(t, sink.Close())
+
+	data, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err)
+	require.Len(t, data, wavHeaderSize+8)
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, "WAVE", string(data[8:12]))
+	assert.Equal(t, uint32(SampleRate), binary.LittleEndian.Uint32(data[24:]))
+	assert.Equal(t, "data", string(data[36:40]))
+	assert.Equal(t, uint32(8), binary.LittleEndian.Uint32(data[40:]))
+	assert.Equal(t, []byte{1, 0, 0xFF, 0xFF, 0x34, 0x12, 0, 0}, data[wavHeaderSize:])
+}
+
+// TestSink_WAVFull asserts that the WAV sink stops writing before the size of
+// the data overflows the header.
+func TestSink_WAVFull(t *testing.T) {
+	file, err := ioutil.TempFile("", "goboy-wav")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	sink, err := NewWAVSink(file)
+	require.NoError(t, err)
+	sink.size = wavMaxDataSize - 4
+	frames := []Frame{{Left: 1, Right: 1}, {Left: 2, Right: 2}}
+	assert.Equal(t, ErrWAVFull, sink.WriteFrames(frames))
+	assert.Equal(t, ErrWAVFull, sink.WriteFrames(frames))
+	require.NoError(t, sink.Close())
+
+	data, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err)
+	require.Len(t, data, wavHeaderSize+4, "only the frame which fits should be written")
+	assert.Equal(t, uint32(math.MaxUint32-3), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, uint32(wavMaxDataSize), binary.LittleEndian.Uint32(data[40:]))
+}
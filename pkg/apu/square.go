@@ -0,0 +1,125 @@
+package apu
+
+// Waveforms for each of the duty cycles of the square channels.
+var dutyPatterns = [4][8]byte{
+	{0, 0, 0, 0, 0, 0, 0, 1}, // 12.5%
+	{1, 0, 0, 0, 0, 0, 0, 1}, // 25%
+	{1, 0, 0, 0, 0, 1, 1, 1}, // 50%
+	{0, 1, 1, 1, 1, 1, 1, 0}, // 75%
+}
+
+// Square channel, used for channels 1 and 2. Channel 1 also has a frequency
+// sweep.
+type squareChannel struct {
+	channel
+	Envelope envelope
+
+	Duty      byte
+	DutyStep  byte
+	Frequency uint16
+	Timer     int
+
+	// Frequency sweep, only used by channel 1
+	SweepPeriod  byte
+	SweepNegate  bool
+	SweepShift   byte
+	SweepTimer   byte
+	SweepEnabled bool
+	SweepShadow  uint16
+	// Set once the sweep has calculated a frequency in negate mode, after
+	// which clearing the negate bit disables the channel.
+	SweepNegated bool
+}
+
+// Get the number of cycles between each step of the duty cycle.
+func (chn *squareChannel) period() int {
+	return (2048 - int(chn.Frequency)) * 4
+}
+
+// Advance the frequency timer of the channel by a number of cycles.
+func (chn *squareChannel) step(cycles int) {
+	chn.Timer -= cycles
+	for chn.Timer <= 0 {
+		chn.Timer += chn.period()
+		chn.DutyStep = (chn.DutyStep + 1) % 8
+	}
+}
+
+// Get the current output of the channel, between 0 and 15.
+func (chn *squareChannel) output() byte {
+	if !chn.Enabled || chn.debugOff {
+		return 0
+	}
+	return dutyPatterns[chn.Duty][chn.DutyStep] * chn.Envelope.Volume
+}
+
+// Restart the channel when it has been triggered.
+func (chn *squareChannel) trigger() {
+	chn.Timer = chn.period()
+	chn.Envelope.trigger()
+
+	chn.SweepShadow = chn.Frequency
+	chn.SweepTimer = sweepTimerPeriod(chn.SweepPeriod)
+	chn.SweepEnabled = chn.SweepPeriod != 0 || chn.SweepShift != 0
+	chn.SweepNegated = false
+	if chn.SweepShift != 0 {
+		chn.sweepFrequency()
+	}
+}
+
+// Write to the NR10 sweep register.
+func (chn *squareChannel) writeSweep(value byte) {
+	chn.SweepPeriod = (value >> 4) & 0x7
+	chn.SweepNegate = value&0x8 != 0
+	chn.SweepShift = value & 0x7
+	if !chn.SweepNegate && chn.SweepNegated {
+		chn.Enabled = false
+	}
+}
+
+// Clock the frequency sweep, which is done by the frame sequencer at 128 Hz.
+// The new frequency is written back to the channel and checked for overflow
+// again, and the channel is disabled if either calculation overflows.
+func (chn *squareChannel) clockSweep() {
+	if chn.SweepTimer > 0 {
+		chn.SweepTimer--
+	}
+	if chn.SweepTimer > 0 {
+		return
+	}
+	chn.SweepTimer = sweepTimerPeriod(chn.SweepPeriod)
+	if !chn.SweepEnabled || chn.SweepPeriod == 0 {
+		return
+	}
+
+	frequency := chn.sweepFrequency()
+	if frequency <= 2047 && chn.SweepShift != 0 {
+		chn.SweepShadow = frequency
+		chn.Frequency = frequency
+		chn.sweepFrequency()
+	}
+}
+
+// Calculate the next frequency of the sweep, disabling the channel if it is
+// above the maximum frequency.
+func (chn *squareChannel) sweepFrequency() uint16 {
+	delta := chn.SweepShadow >> chn.SweepShift
+	frequency := chn.SweepShadow + delta
+	if chn.SweepNegate {
+		frequency = chn.SweepShadow - delta
+		chn.SweepNegated = true
+	}
+	if frequency > 2047 {
+		chn.Enabled = false
+	}
+	return frequency
+}
+
+// Get the value the sweep timer is reloaded with. A period of 0 is treated as
+// 8 by the timer.
+func sweepTimerPeriod(period byte) byte {
+	if period == 0 {
+		return 8
+	}
+	return period
+}
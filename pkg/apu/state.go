@@ -0,0 +1,67 @@
+package apu
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// State of the APU which is stored in a save state. States from before the
+// APU was clocked by the frame sequencer are loaded with the APU turned off.
+type apuState struct {
+	Enabled       bool
+	Registers     [0x30]byte
+	SequencerStep int
+	TickCounter   float64
+	Filter        highPassFilter
+
+	Square1 squareChannel
+	Square2 squareChannel
+	Wave    waveChannel
+	Noise   noiseChannel
+}
+
+// SaveState returns a snapshot of the APU registers and channels which can
+// be restored with LoadState.
+func (a *APU) SaveState() ([]byte, error) {
+	state := apuState{
+		Enabled:       a.enabled,
+		Registers:     a.memory,
+		SequencerStep: a.sequencerStep,
+		TickCounter:   a.tickCounter,
+		Filter:        a.filter,
+		Square1:       *a.chn1,
+		Square2:       *a.chn2,
+		Wave:          *a.chn3,
+		Noise:         *a.chn4,
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadState restores the APU from a snapshot created by SaveState.
+func (a *APU) LoadState(data []byte) error {
+	var state apuState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return err
+	}
+	a.enabled = state.Enabled
+	a.memory = state.Registers
+	a.sequencerStep = state.SequencerStep
+	a.tickCounter = state.TickCounter
+	a.filter = state.Filter
+
+	// Keep the debug flags which are not part of the state
+	state.Square1.debugOff = a.chn1.debugOff
+	state.Square2.debugOff = a.chn2.debugOff
+	state.Wave.debugOff = a.chn3.debugOff
+	state.Noise.debugOff = a.chn4.debugOff
+	*a.chn1 = state.Square1
+	*a.chn2 = state.Square2
+	*a.chn3 = state.Wave
+	*a.chn4 = state.Noise
+	return nil
+}
@@ -0,0 +1,97 @@
+package apu
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	// Size of the header of a WAV file.
+	wavHeaderSize = 44
+	// Maximum size of the data of a WAV file in whole frames, so that the
+	// size of the RIFF chunk fits in its 32-bit field.
+	wavMaxDataSize = (math.MaxUint32 - (wavHeaderSize - 8)) / 4 * 4
+)
+
+// ErrWAVFull is returned by a WAVSink when the frames would make the WAV file
+// larger than the 4 GiB its header can describe.
+var ErrWAVFull = errors.New("wav file is full")
+
+// WAVSink is an AudioSink which writes the audio to a 16-bit stereo PCM WAV
+// file. The sizes in the header are written when the sink is closed.
+type WAVSink struct {
+	w    io.WriteSeeker
+	size uint32
+}
+
+// NewWAVSink creates a WAVSink which writes to a file or other seekable
+// writer.
+func NewWAVSink(w io.WriteSeeker) (*WAVSink, error) {
+	sink := &WAVSink{w: w}
+	if err := sink.writeHeader(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// WriteFrames writes the frames to the WAV data. Once the file is full the
+// frames which do not fit are dropped and ErrWAVFull is returned.
+func (s *WAVSink) WriteFrames(frames []Frame) error {
+	var full bool
+	if space := (wavMaxDataSize - s.size) / 4; uint32(len(frames)) > space {
+		frames = frames[:space]
+		full = true
+	}
+	n, err := s.w.Write(EncodeFrames(frames))
+	s.size += uint32(n)
+	if err == nil && full {
+		err = ErrWAVFull
+	}
+	return err
+}
+
+// Close updates the header with the size of the data which has been written.
+// The underlying writer is not closed.
+func (s *WAVSink) Close() error {
+	if _, err := s.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	_, err := s.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Write the RIFF header of the WAV file.
+func (s *WAVSink) writeHeader() error {
+	const (
+		channels      = 2
+		bytesPerFrame = channels * 2
+	)
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(wavHeaderSize - 8 + s.size),
+		[4]byte{'W', 'A', 'V', 'E'},
+
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),                         // Size of the format chunk
+		uint16(1),                          // PCM format
+		uint16(channels),                   // Channels
+		uint32(SampleRate),                 // Sample rate
+		uint32(SampleRate * bytesPerFrame), // Byte rate
+		uint16(bytesPerFrame),              // Block align
+		uint16(16),                         // Bits per sample
+
+		[4]byte{'d', 'a', 't', 'a'},
+		s.size,
+	}
+	for _, field := range header {
+		if err := binary.Write(s.w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package apu
+
+// Amount the 4-bit wave samples are shifted right by for each volume code.
+var waveVolumeShift = [4]byte{4, 0, 1, 2}
+
+// Wave channel, used for channel 3. The channel plays 32 4-bit samples from
+// the wave RAM.
+type waveChannel struct {
+	channel
+
+	VolumeCode byte
+	Frequency  uint16
+	Timer      int
+	// Index of the sample being played, and the sample itself
+	Position byte
+	Sample   byte
+	// Number of cycles since the sample was read from the wave RAM
+	SinceRead int
+
+	RAM [16]byte
+}
+
+// Get the number of cycles between each sample.
+func (chn *waveChannel) period() int {
+	return (2048 - int(chn.Frequency)) * 2
+}
+
+// Advance the frequency timer of the channel by a number of cycles.
+func (chn *waveChannel) step(cycles int) {
+	chn.Timer -= cycles
+	chn.SinceRead += cycles
+	for chn.Timer <= 0 {
+		chn.SinceRead = -chn.Timer
+		chn.Timer += chn.period()
+		chn.Position = (chn.Position + 1) % 32
+		chn.Sample = chn.sampleAt(chn.Position)
+	}
+}
+
+// Get the 4-bit sample at an index in the wave RAM. The high nibble of each
+// byte is played first.
+func (chn *waveChannel) sampleAt(index byte) byte {
+	value := chn.RAM[index/2]
+	if index%2 == 0 {
+		return value >> 4
+	}
+	return value & 0xF
+}
+
+// Check if the channel has just read a sample from the wave RAM. The DMG can
+// only access the wave RAM while the channel is playing in the same cycle as
+// the channel reads it.
+func (chn *waveChannel) justRead() bool {
+	return chn.SinceRead < 2
+}
+
+// Corrupt the wave RAM when the channel is triggered on the DMG while it is
+// about to read the next sample. The first bytes are overwritten by the byte
+// which was going to be read or, after the first 4 bytes, by the 4 byte
+// aligned block containing it.
+func (chn *waveChannel) corruptRAM() {
+	if chn.Timer > 2 {
+		return
+	}
+	index := ((chn.Position + 1) % 32) / 2
+	if index < 4 {
+		chn.RAM[0] = chn.RAM[index]
+		return
+	}
+	block := index &^ 3
+	copy(chn.RAM[:4], chn.RAM[block:block+4])
+}
+
+// Get the current output of the channel, between 0 and 15.
+func (chn *waveChannel) output() byte {
+	if !chn.Enabled || chn.debugOff {
+		return 0
+	}
+	return chn.Sample >> waveVolumeShift[chn.VolumeCode]
+}
+
+// Restart the channel when it has been triggered. The position is reset but
+// the sample is not read until the timer next expires.
+func (chn *waveChannel) trigger() {
+	chn.Timer = chn.period()
+	chn.Position = 0
+	chn.SinceRead = chn.Timer
+}
@@ -3,10 +3,10 @@ package cart
 import (
 	"archive/zip"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"strings"
-	"time"
 )
 
 // Mode represents the types of mode the GameBoy can run in.
@@ -45,6 +45,21 @@ type BankingController interface {
 	// LoadSaveData loads some save data into the cartridge. The banking
 	// controller implementation can decide how this data should be loaded.
 	LoadSaveData(data []byte)
+
+	// IsDirty returns if the RAM has been written to since it was last marked
+	// as saved with MarkSaved.
+	IsDirty() bool
+
+	// MarkSaved records that the save data has been stored, so the RAM is no
+	// longer dirty.
+	MarkSaved()
+
+	// SaveState returns a snapshot of the controller's banking registers and
+	// RAM which can be restored with LoadState.
+	SaveState() ([]byte, error)
+
+	// LoadState restores the controller to a snapshot created by SaveState.
+	LoadState(data []byte) error
 }
 
 // Cart represents a GameBoy cartridge.
@@ -55,9 +70,13 @@ type BankingController interface {
 // time clock).
 type Cart struct {
 	BankingController
-	title    string
-	filename string
-	mode     Mode
+	title string
+	name  string
+	mode  Mode
+
+	// Storage for the save data if the cartridge has a battery.
+	store   SaveStore
+	battery bool
 }
 
 // GetName returns the name of the cartridge. This is retrieved from the memory location
@@ -77,62 +96,64 @@ func (c *Cart) GetName() string {
 	return c.title
 }
 
-// GetSaveFilename returns the name of the file that the game should be saved to. This is
-// used for saving and loading save data to the cartridge.
-// TODO: do something better here
-func (c *Cart) GetSaveFilename() string {
-	return c.filename + ".sav"
-}
-
 // GetMode returns the modes that this cart can run in.
 func (c *Cart) GetMode() Mode {
 	return c.mode
 }
 
-// Attempt to load a save game from the expected location.
-func (c *Cart) initGameSaves() {
-	saveData, err := ioutil.ReadFile(c.GetSaveFilename())
-	if err == nil {
+// Attempt to load a save game from the save store.
+func (c *Cart) loadGameSave() {
+	saveData, err := c.store.Load(c.name)
+	if err != nil {
+		log.Printf("Error loading cartridge RAM: %v", err)
+	} else if saveData != nil {
 		c.LoadSaveData(saveData)
 	}
-	// Write the RAM to file every second
-	// TODO: improve this behaviour
-	ticker := time.NewTicker(time.Second)
-	go func() {
-		for range ticker.C {
-			c.Save()
-		}
-	}()
 }
 
-// Save dumps the carts RAM to the save location.
-func (c *Cart) Save() {
+// Save writes the carts RAM to the save store if the cartridge has a battery and
+// the RAM has been written to since it was last saved.
+func (c *Cart) Save() error {
+	if c.store == nil || !c.battery || !c.IsDirty() {
+		return nil
+	}
 	data := c.BankingController.GetSaveData()
-	if len(data) > 0 {
-		err := ioutil.WriteFile(c.GetSaveFilename(), data, 0644)
-		if err != nil {
-			log.Printf("Error saving cartridge RAM: %v", err)
-		}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := c.store.Store(c.name, data); err != nil {
+		return fmt.Errorf("saving cartridge RAM: %v", err)
 	}
+	// The RAM stays dirty if it could not be stored so that it is retried
+	c.BankingController.MarkSaved()
+	return nil
 }
 
-// NewCartFromFile loads a cartridge ROM from a file.
+// NewCartFromFile loads a cartridge ROM from a file. Save data will be stored in
+// a file next to the ROM.
 func NewCartFromFile(filename string) (*Cart, error) {
-	rom, err := loadROMData(filename)
+	rom, err := LoadROMFile(filename)
 	if err != nil {
 		return nil, err
 	}
 	return NewCart(rom, filename), nil
 }
 
-// NewCart loads a cartridge ROM from a byte array and returns a new cartridge with
-// the correct memory banking controller. If the game supports saves, then the
-// save file for the cartridge will also be loaded, and the saving loop will be
-// started to write the save data back to file.
+// NewCart loads a cartridge ROM from a byte array and returns a new cartridge. Save
+// data will be stored in a file next to the ROM filename. See NewCartWithStore.
+func NewCart(rom []byte, filename string) *Cart {
+	return NewCartWithStore(rom, filename, FileSaveStore{})
+}
+
+// NewCartWithStore loads a cartridge ROM from a byte array and returns a new cartridge
+// with the correct memory banking controller. If the game supports saves, then the
+// save data for the cartridge will be loaded from the store using the name, and will
+// be written back to the store when Save is called. If the name is empty then the
+// title of the cartridge is used. If the store is nil then the game will not be saved.
 //
 // The function will use the following list to determine which MBC to use. Not
-// all of the controllers are supported, and the function will only start the
-// save loop for controllers which support RAM+BATTERY.
+// all of the controllers are supported, and the function will only load and save
+// data for controllers which support RAM+BATTERY.
 //
 //     0x00  ROM ONLY
 //     0x01  MBC1
@@ -163,9 +184,10 @@ func NewCartFromFile(filename string) (*Cart, error) {
 //     0xFD  BANDAI TAMA5
 //     0xFE  HuC3
 //     0xFF  HuC1+RAM+BATTERY
-func NewCart(rom []byte, filename string) *Cart {
+func NewCartWithStore(rom []byte, name string, store SaveStore) *Cart {
 	cartridge := Cart{
-		filename: filename,
+		name:  name,
+		store: store,
 	}
 
 	// Check for GB mode
@@ -210,16 +232,23 @@ func NewCart(rom []byte, filename string) *Cart {
 	}
 	log.Printf("Cart type: %#02x (%v)", mbcFlag, cartType)
 
+	if cartridge.name == "" {
+		cartridge.name = cartridge.GetName()
+	}
+
 	switch mbcFlag {
 	case 0x3, 0x6, 0x9, 0xD, 0xF, 0x10, 0x13, 0x17, 0x1B, 0x1E, 0xFF:
-		cartridge.initGameSaves()
+		cartridge.battery = true
+		if cartridge.store != nil {
+			cartridge.loadGameSave()
+		}
 	}
 	return &cartridge
 }
 
-// Open the file and load the data out of it as an array of bytes. If the file is
-// a zip file containing one file, then open that as the rom instead.
-func loadROMData(filename string) ([]byte, error) {
+// LoadROMFile opens the file and loads the data out of it as an array of bytes. If
+// the file is a zip file containing one file, then open that as the rom instead.
+func LoadROMFile(filename string) ([]byte, error) {
 	var data []byte
 	if strings.HasSuffix(filename, ".zip") {
 		return loadZIPData(filename)
@@ -17,6 +17,7 @@ type MBC1 struct {
 	ram        []byte
 	ramBank    uint32
 	ramEnabled bool
+	dirty      bool
 
 	romBanking bool
 }
@@ -77,6 +78,7 @@ func (r *MBC1) updateRomBankIfZero() {
 func (r *MBC1) WriteRAM(address uint16, value byte) {
 	if r.ramEnabled {
 		r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
+		r.dirty = true
 	}
 }
 
@@ -91,3 +93,48 @@ func (r *MBC1) GetSaveData() []byte {
 func (r *MBC1) LoadSaveData(data []byte) {
 	r.ram = data
 }
+
+// IsDirty returns if the RAM has been written to since it was last saved.
+func (r *MBC1) IsDirty() bool {
+	return r.dirty
+}
+
+// MarkSaved records that the RAM has been saved.
+func (r *MBC1) MarkSaved() {
+	r.dirty = false
+}
+
+// State of the MBC1 controller which is stored in a save state.
+type mbc1State struct {
+	ROMBank    uint32
+	RAM        []byte
+	RAMBank    uint32
+	RAMEnabled bool
+	ROMBanking bool
+}
+
+// SaveState returns a snapshot of the banking registers and RAM.
+func (r *MBC1) SaveState() ([]byte, error) {
+	return encodeState(mbc1State{
+		ROMBank:    r.romBank,
+		RAM:        r.ram,
+		RAMBank:    r.ramBank,
+		RAMEnabled: r.ramEnabled,
+		ROMBanking: r.romBanking,
+	})
+}
+
+// LoadState restores the banking registers and RAM from a snapshot.
+func (r *MBC1) LoadState(data []byte) error {
+	var state mbc1State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	r.ram = state.RAM
+	r.dirty = true
+	r.ramBank = state.RAMBank
+	r.ramEnabled = state.RAMEnabled
+	r.romBanking = state.ROMBanking
+	return nil
+}
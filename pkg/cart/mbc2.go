@@ -16,6 +16,7 @@ type MBC2 struct {
 
 	ram        []byte
 	ramEnabled bool
+	dirty      bool
 }
 
 // Read returns a value at a memory address in the ROM or RAM.
@@ -59,6 +60,7 @@ func (r *MBC2) WriteROM(address uint16, value byte) {
 func (r *MBC2) WriteRAM(address uint16, value byte) {
 	if r.ramEnabled {
 		r.ram[address-0xA000] = value & 0xF
+		r.dirty = true
 	}
 }
 
@@ -73,3 +75,42 @@ func (r *MBC2) GetSaveData() []byte {
 func (r *MBC2) LoadSaveData(data []byte) {
 	r.ram = data
 }
+
+// IsDirty returns if the RAM has been written to since it was last saved.
+func (r *MBC2) IsDirty() bool {
+	return r.dirty
+}
+
+// MarkSaved records that the RAM has been saved.
+func (r *MBC2) MarkSaved() {
+	r.dirty = false
+}
+
+// State of the MBC2 controller which is stored in a save state.
+type mbc2State struct {
+	ROMBank    uint32
+	RAM        []byte
+	RAMEnabled bool
+}
+
+// SaveState returns a snapshot of the banking registers and RAM.
+func (r *MBC2) SaveState() ([]byte, error) {
+	return encodeState(mbc2State{
+		ROMBank:    r.romBank,
+		RAM:        r.ram,
+		RAMEnabled: r.ramEnabled,
+	})
+}
+
+// LoadState restores the banking registers and RAM from a snapshot.
+func (r *MBC2) LoadState(data []byte) error {
+	var state mbc2State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	r.ram = state.RAM
+	r.dirty = true
+	r.ramEnabled = state.RAMEnabled
+	return nil
+}
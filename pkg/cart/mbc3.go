@@ -20,6 +20,7 @@ type MBC3 struct {
 	ram        []byte
 	ramBank    uint32
 	ramEnabled bool
+	dirty      bool
 
 	rtc        []byte
 	latchedRtc []byte
@@ -75,6 +76,7 @@ func (r *MBC3) WriteRAM(address uint16, value byte) {
 			r.rtc[r.ramBank] = value
 		} else {
 			r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
+			r.dirty = true
 		}
 	}
 }
@@ -90,3 +92,54 @@ func (r *MBC3) GetSaveData() []byte {
 func (r *MBC3) LoadSaveData(data []byte) {
 	r.ram = data
 }
+
+// IsDirty returns if the RAM has been written to since it was last saved.
+func (r *MBC3) IsDirty() bool {
+	return r.dirty
+}
+
+// MarkSaved records that the RAM has been saved.
+func (r *MBC3) MarkSaved() {
+	r.dirty = false
+}
+
+// State of the MBC3 controller which is stored in a save state.
+type mbc3State struct {
+	ROMBank    uint32
+	RAM        []byte
+	RAMBank    uint32
+	RAMEnabled bool
+	RTC        []byte
+	LatchedRTC []byte
+	Latched    bool
+}
+
+// SaveState returns a snapshot of the banking registers, RAM and RTC.
+func (r *MBC3) SaveState() ([]byte, error) {
+	return encodeState(mbc3State{
+		ROMBank:    r.romBank,
+		RAM:        r.ram,
+		RAMBank:    r.ramBank,
+		RAMEnabled: r.ramEnabled,
+		RTC:        r.rtc,
+		LatchedRTC: r.latchedRtc,
+		Latched:    r.latched,
+	})
+}
+
+// LoadState restores the banking registers, RAM and RTC from a snapshot.
+func (r *MBC3) LoadState(data []byte) error {
+	var state mbc3State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	r.ram = state.RAM
+	r.dirty = true
+	r.ramBank = state.RAMBank
+	r.ramEnabled = state.RAMEnabled
+	r.rtc = state.RTC
+	r.latchedRtc = state.LatchedRTC
+	r.latched = state.Latched
+	return nil
+}
@@ -17,6 +17,7 @@ type MBC5 struct {
 	ram        []byte
 	ramBank    uint32
 	ramEnabled bool
+	dirty      bool
 }
 
 // Read returns a value at a memory address in the ROM.
@@ -56,6 +57,7 @@ func (r *MBC5) WriteROM(address uint16, value byte) {
 func (r *MBC5) WriteRAM(address uint16, value byte) {
 	if r.ramEnabled {
 		r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
+		r.dirty = true
 	}
 }
 
@@ -70,3 +72,45 @@ func (r *MBC5) GetSaveData() []byte {
 func (r *MBC5) LoadSaveData(data []byte) {
 	r.ram = data
 }
+
+// IsDirty returns if the RAM has been written to since it was last saved.
+func (r *MBC5) IsDirty() bool {
+	return r.dirty
+}
+
+// MarkSaved records that the RAM has been saved.
+func (r *MBC5) MarkSaved() {
+	r.dirty = false
+}
+
+// State of the MBC5 controller which is stored in a save state.
+type mbc5State struct {
+	ROMBank    uint32
+	RAM        []byte
+	RAMBank    uint32
+	RAMEnabled bool
+}
+
+// SaveState returns a snapshot of the banking registers and RAM.
+func (r *MBC5) SaveState() ([]byte, error) {
+	return encodeState(mbc5State{
+		ROMBank:    r.romBank,
+		RAM:        r.ram,
+		RAMBank:    r.ramBank,
+		RAMEnabled: r.ramEnabled,
+	})
+}
+
+// LoadState restores the banking registers and RAM from a snapshot.
+func (r *MBC5) LoadState(data []byte) error {
+	var state mbc5State
+	if err := decodeState(data, &state); err != nil {
+		return err
+	}
+	r.romBank = state.ROMBank
+	r.ram = state.RAM
+	r.dirty = true
+	r.ramBank = state.RAMBank
+	r.ramEnabled = state.RAMEnabled
+	return nil
+}
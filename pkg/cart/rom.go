@@ -35,3 +35,25 @@ func (r *ROM) GetSaveData() []byte {
 // LoadSaveData loads the save data into the cartridge. As RAM is not supported
 // on this memory controller, this is a noop.
 func (r *ROM) LoadSaveData([]byte) {}
+
+// IsDirty returns if the RAM has been written to. As RAM is not supported on
+// this memory controller, this is always false.
+func (r *ROM) IsDirty() bool {
+	return false
+}
+
+// MarkSaved records that the RAM has been saved. As RAM is not supported on
+// this memory controller, this is a noop.
+func (r *ROM) MarkSaved() {}
+
+// SaveState returns a snapshot of the controller. As a ROM cart has no
+// banking or RAM, there is no state to save.
+func (r *ROM) SaveState() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// LoadState restores the controller from a snapshot. As a ROM cart has no
+// banking or RAM, this is a noop.
+func (r *ROM) LoadState([]byte) error {
+	return nil
+}
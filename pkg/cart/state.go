@@ -0,0 +1,20 @@
+package cart
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Encode a controller state struct into a byte array.
+func encodeState(state interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode a byte array created by encodeState into a controller state struct.
+func decodeState(data []byte, state interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(state)
+}
@@ -0,0 +1,125 @@
+package cart
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SaveStore provides storage for the battery backed RAM of cartridges. Save
+// data is keyed by a name which identifies the cartridge.
+type SaveStore interface {
+	// Load returns the save data stored for a cartridge. If no save data has
+	// been stored then nil is returned with no error.
+	Load(name string) ([]byte, error)
+
+	// Store writes the save data for a cartridge, replacing any existing data.
+	Store(name string, data []byte) error
+}
+
+// FileSaveStore stores save data in a file next to the ROM, where the name of
+// the cartridge is the path to the ROM file. For example the save data for
+// `zelda.gb` is stored in `zelda.gb.sav`.
+type FileSaveStore struct{}
+
+// Load returns the save data from the save file for the cartridge.
+func (FileSaveStore) Load(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(name + ".sav")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Store writes the save data to the save file for the cartridge.
+func (FileSaveStore) Store(name string, data []byte) error {
+	return writeFileAtomic(name+".sav", data)
+}
+
+// DirectorySaveStore stores save data in files in a directory. The save file
+// is named using the base name of the cartridge, so for example the save data
+// for `roms/zelda.gb` is stored in `<Dir>/zelda.gb.sav`.
+type DirectorySaveStore struct {
+	Dir string
+}
+
+// Get the path to the save file for a cartridge.
+func (s DirectorySaveStore) path(name string) string {
+	return filepath.Join(s.Dir, filepath.Base(name)+".sav")
+}
+
+// Load returns the save data from the save file for the cartridge.
+func (s DirectorySaveStore) Load(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Store writes the save data to the save file for the cartridge, creating the
+// directory if it does not exist.
+func (s DirectorySaveStore) Store(name string, data []byte) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(name), data)
+}
+
+// MemorySaveStore stores save data in memory. It is safe for concurrent use.
+type MemorySaveStore struct {
+	mutex sync.Mutex
+	saves map[string][]byte
+}
+
+// NewMemorySaveStore returns a new empty MemorySaveStore.
+func NewMemorySaveStore() *MemorySaveStore {
+	return &MemorySaveStore{saves: map[string][]byte{}}
+}
+
+// Load returns a copy of the save data stored for the cartridge.
+func (s *MemorySaveStore) Load(name string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.saves[name]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, data...), nil
+}
+
+// Store keeps a copy of the save data for the cartridge.
+func (s *MemorySaveStore) Store(name string, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.saves[name] = append([]byte{}, data...)
+	return nil
+}
+
+// Write data to a file by first writing it to a temporary file and then renaming
+// it, so that the file is never left partially written.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file if anything fails
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,121 @@
+package cart
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemorySaveStore(t *testing.T) {
+	store := NewMemorySaveStore()
+
+	data, err := store.Load("game")
+	require.NoError(t, err)
+	assert.Nil(t, data, "expected no data for unsaved game")
+
+	saved := []byte{1, 2, 3}
+	require.NoError(t, store.Store("game", saved))
+	saved[0] = 4
+
+	data, err = store.Load("game")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, data, "store should keep a copy of the data")
+}
+
+// Build a MBC1 rom with a battery.
+func batteryROM() []byte {
+	return appendBytes(
+		bytes.Repeat([]byte{0}, 0x134),
+		[]byte("SAVEGAME"),
+		bytes.Repeat([]byte{0}, 0x147-0x134-8),
+		[]byte{0x03}, // MBC1+RAM+BATTERY
+		bytes.Repeat([]byte{0}, 0x8000-0x148),
+	)
+}
+
+func TestNewCartWithStore(t *testing.T) {
+	saveData := make([]byte, 0x8000)
+	saveData[0] = 0x42
+
+	store := NewMemorySaveStore()
+	require.NoError(t, store.Store("SAVEGAME", saveData))
+
+	cart := NewCartWithStore(batteryROM(), "", store)
+	assert.Equal(t, byte(0x42), cart.Read(0xA000), "save data was not loaded from the store")
+}
+
+func TestDirectorySaveStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goboy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := DirectorySaveStore{Dir: filepath.Join(dir, "saves")}
+	data, err := store.Load("roms/game.gb")
+	require.NoError(t, err)
+	assert.Nil(t, data, "expected no data for unsaved game")
+
+	require.NoError(t, store.Store("roms/game.gb", []byte{1, 2, 3}))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "saves", "game.gb.sav"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, data)
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "saves"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files were not cleaned up")
+}
+
+func TestCart_Save(t *testing.T) {
+	store := NewMemorySaveStore()
+	cart := NewCartWithStore(batteryROM(), "", store)
+
+	require.NoError(t, cart.Save())
+	data, err := store.Load("SAVEGAME")
+	require.NoError(t, err)
+	assert.Nil(t, data, "should not save before the RAM is written to")
+
+	cart.WriteROM(0x0000, 0x0A) // Enable RAM
+	cart.WriteRAM(0xA000, 0x42)
+	require.NoError(t, cart.Save())
+	data, err = store.Load("SAVEGAME")
+	require.NoError(t, err)
+	require.NotNil(t, data, "should save after the RAM is written to")
+	assert.Equal(t, byte(0x42), data[0])
+	assert.False(t, cart.IsDirty(), "should not be dirty after saving")
+}
+
+// Save store which fails to store the save data until it is allowed to.
+type failingSaveStore struct {
+	*MemorySaveStore
+	fail bool
+}
+
+func (s *failingSaveStore) Store(name string, data []byte) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemorySaveStore.Store(name, data)
+}
+
+func TestCart_SaveRetry(t *testing.T) {
+	store := &failingSaveStore{MemorySaveStore: NewMemorySaveStore(), fail: true}
+	cart := NewCartWithStore(batteryROM(), "", store)
+
+	cart.WriteROM(0x0000, 0x0A) // Enable RAM
+	cart.WriteRAM(0xA000, 0x42)
+	assert.Error(t, cart.Save())
+	assert.True(t, cart.IsDirty(), "should still be dirty after failing to save")
+
+	store.fail = false
+	require.NoError(t, cart.Save())
+	data, err := store.Load("SAVEGAME")
+	require.NoError(t, err)
+	require.NotNil(t, data, "should retry saving after a failure")
+	assert.Equal(t, byte(0x42), data[0])
+	assert.False(t, cart.IsDirty(), "should not be dirty after saving")
+}
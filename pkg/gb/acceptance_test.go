@@ -34,10 +34,95 @@ func _TestAcceptance(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// TestAcceptance_Timer runs the mooneye timer test roms.
+func TestAcceptance_Timer(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(romPath, "timer", "*.gb"))
+	require.NoError(t, err)
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			runMooneyeTest(t, file)
+		})
+	}
+}
+
+// TestAcceptance_Halt runs the mooneye HALT test roms which currently pass.
+func TestAcceptance_Halt(t *testing.T) {
+	for _, name := range []string{"halt_ime0_ei", "halt_ime1_timing"} {
+		t.Run(name, func(t *testing.T) {
+			runMooneyeTest(t, filepath.Join(romPath, name+".gb"))
+		})
+	}
+}
+
+// TestAcceptance_Timing runs the mooneye test roms for the timing of memory
+// accesses and interrupts within instructions which currently pass.
+func TestAcceptance_Timing(t *testing.T) {
+	names := []string{
+		"halt_ime0_nointr_timing", "halt_ime1_timing2-GS", "pop_timing", "push_timing",
+		"add_sp_e_timing", "ld_hl_sp_e_timing", "call_timing", "call_timing2", "call_cc_timing",
+		"call_cc_timing2", "jp_timing", "jp_cc_timing", "ret_timing", "ret_cc_timing",
+		"reti_timing", "rst_timing",
+		"ppu/intr_1_2_timing-GS", "ppu/intr_2_0_timing", "ppu/intr_2_mode0_timing",
+		"ppu/intr_2_mode0_timing_sprites", "ppu/intr_2_mode3_timing", "ppu/intr_2_oam_ok_timing",
+		"ppu/hblank_ly_scx_timing-GS",
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			runMooneyeTest(t, filepath.Join(romPath, name+".gb"))
+		})
+	}
+}
+
+// TestAcceptance_Interrupts runs the mooneye test roms for the timing of
+// interrupt dispatch and the EI, DI and RETI instructions.
+func TestAcceptance_Interrupts(t *testing.T) {
+	names := []string{
+		"di_timing-GS", "ei_sequence", "ei_timing", "if_ie_registers", "intr_timing",
+		"rapid_di_ei", "reti_intr_timing", "interrupts/ie_push",
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			runMooneyeTest(t, filepath.Join(romPath, name+".gb"))
+		})
+	}
+}
+
+// TestAcceptance_OAMDMA runs the mooneye test roms for the timing and sources
+// of the OAM DMA.
+func TestAcceptance_OAMDMA(t *testing.T) {
+	names := []string{
+		"oam_dma_start", "oam_dma_timing", "oam_dma_restart",
+		"oam_dma/basic", "oam_dma/reg_read", "oam_dma/sources-dmgABCmgbS",
+	}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			runMooneyeTest(t, filepath.Join(romPath, name+".gb"))
+		})
+	}
+}
+
+// TestAcceptance_STAT runs the mooneye test roms for the STAT interrupt line
+// and the LY=LYC comparison which currently pass.
+func TestAcceptance_STAT(t *testing.T) {
+	names := []string{"ppu/stat_irq_blocking", "ppu/stat_lyc_onoff", "ppu/vblank_stat_intr-GS"}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			runMooneyeTest(t, filepath.Join(romPath, name+".gb"))
+		})
+	}
+}
+
+// Check if the CPU is in the NOP, JR -3 loop which the test roms finish in.
+// The CPU may be on either instruction of the loop.
 func inFinishLoop(gb *Gameboy) bool {
-	return gb.Memory.Read(gb.CPU.PC) == 0x00 &&
-		gb.Memory.Read(gb.CPU.PC+1) == 0x18 &&
-		gb.Memory.Read(gb.CPU.PC+2) == 0xFD
+	pc := gb.CPU.PC
+	if gb.Memory.Read(pc) == 0x18 {
+		pc--
+	}
+	return gb.Memory.Read(pc) == 0x00 &&
+		gb.Memory.Read(pc+1) == 0x18 &&
+		gb.Memory.Read(pc+2) == 0xFD
 }
 
 func passedTest(gb *Gameboy) bool {
@@ -0,0 +1,42 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a DMG boot rom which does nothing but unmap itself at the end of the
+// rom, where the real boot rom also unmaps itself.
+func testBootROM() []byte {
+	boot := make([]byte, dmgBootROMSize)
+	copy(boot[0xFC:], []byte{
+		0x3E, 0x01, // LD A,1
+		0xE0, 0x50, // LDH (0x50),A
+	})
+	return boot
+}
+
+// TestBootROM asserts that the boot rom is mapped over the cartridge until it
+// unmaps itself, and that execution then continues into the cartridge.
+func TestBootROM(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	rom[0x00] = 0xAB
+	gb, err := NewGameboyFromROM(rom, WithBootROM(testBootROM()))
+	require.NoError(t, err, "error in init gb %v", err)
+	assert.Equal(t, uint16(0x0000), gb.CPU.PC, "boot rom should start at 0x0000")
+	assert.Equal(t, byte(0x00), gb.Memory.Read(0x0000), "boot rom not mapped")
+	assert.False(t, gb.IsCGB())
+
+	gb.RunUntil(func(gb *Gameboy) bool { return gb.CPU.PC == 0x0100 })
+	assert.Equal(t, byte(0xAB), gb.Memory.Read(0x0000), "boot rom not unmapped")
+	assert.Equal(t, byte(0xFF), gb.Memory.Read(0xFF50))
+}
+
+// TestBootROM_InvalidSize asserts that a boot rom which is not the size of a
+// DMG or CGB boot rom is rejected.
+func TestBootROM_InvalidSize(t *testing.T) {
+	_, err := NewGameboyFromROM(make([]byte, 0x8000), WithBootROM(make([]byte, 0x200)))
+	assert.Error(t, err)
+}
@@ -66,26 +66,34 @@ type CPU struct {
 
 	PC uint16
 	SP register
-
-	Divider int
 }
 
-// Init CPU and its registers to the initial values.
-func (cpu *CPU) Init(cgb bool) {
+// Init CPU and its registers to the values left by the boot ROM of a model.
+// The values depend on if the game being run supports CGB features.
+func (cpu *CPU) Init(model Model, cgbGame bool) {
+	regs := model.bootRegisters(cgbGame)
 	cpu.PC = 0x100
-	if cgb {
-		cpu.AF.Set(0x1180)
-	} else {
-		cpu.AF.Set(0x01B0)
-	}
-	cpu.BC.Set(0x0000)
-	cpu.DE.Set(0xFF56)
-	cpu.HL.Set(0x000D)
+	cpu.AF.Set(regs.AF)
+	cpu.BC.Set(regs.BC)
+	cpu.DE.Set(regs.DE)
+	cpu.HL.Set(regs.HL)
 	cpu.SP.Set(0xFFFE)
 
 	cpu.AF.mask = 0xFFF0
 }
 
+// InitBoot sets the CPU to its power on state to start executing the boot ROM.
+func (cpu *CPU) InitBoot() {
+	cpu.PC = 0x0000
+	cpu.AF.Set(0x0000)
+	cpu.BC.Set(0x0000)
+	cpu.DE.Set(0x0000)
+	cpu.HL.Set(0x0000)
+	cpu.SP.Set(0x0000)
+
+	cpu.AF.mask = 0xFFF0
+}
+
 // Internally set the value of a flag on the flag register.
 func (cpu *CPU) setFlag(index byte, on bool) {
 	if on {
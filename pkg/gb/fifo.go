@@ -0,0 +1,77 @@
+package gb
+
+// Pixel which has been fetched by the PPU and is waiting in a pixel FIFO to be
+// pushed to the LCD. The fields are exported so that the FIFOs can be stored in
+// a save state.
+type fifoPixel struct {
+	// Colour number of the pixel, between 0 and 3.
+	Colour byte
+	// Palette of the pixel. This is the CGB palette number, or for a sprite on
+	// the DMG 0 for OBP0 and 1 for OBP1.
+	Palette byte
+	// For background pixels this is the CGB BG-to-OAM priority attribute, and
+	// for sprite pixels it is set if the sprite is drawn behind the background.
+	Priority bool
+	// Index of the sprite in OAM, used for sprite priority on the CGB.
+	OAMIndex byte
+}
+
+// Queue of pixels waiting to be pushed to the LCD. The PPU has one of these for
+// the background and window, and another for the sprites.
+type pixelFIFO struct {
+	Pixels [8]fifoPixel
+	Head   int
+	Size   int
+}
+
+// Add a pixel to the back of the FIFO. The FIFO must not be full.
+func (fifo *pixelFIFO) push(pixel fifoPixel) {
+	fifo.Pixels[(fifo.Head+fifo.Size)%len(fifo.Pixels)] = pixel
+	fifo.Size++
+}
+
+// Remove the pixel at the front of the FIFO. The FIFO must not be empty.
+func (fifo *pixelFIFO) pop() fifoPixel {
+	pixel := fifo.Pixels[fifo.Head]
+	fifo.Head = (fifo.Head + 1) % len(fifo.Pixels)
+	fifo.Size--
+	return pixel
+}
+
+// Get a pointer to the pixel at an index from the front of the FIFO.
+func (fifo *pixelFIFO) at(i int) *fifoPixel {
+	return &fifo.Pixels[(fifo.Head+i)%len(fifo.Pixels)]
+}
+
+// Remove all of the pixels from the FIFO.
+func (fifo *pixelFIFO) clear() {
+	fifo.Head = 0
+	fifo.Size = 0
+}
+
+// State of the background pixel fetcher. The fetcher spends 2 dots reading
+// each of the tile number, the low byte of the tile data and the high byte of
+// the tile data, then waits until the background FIFO is empty to push the
+// row of 8 pixels to it.
+type pixelFetcher struct {
+	// Dot of the current fetch.
+	Step int
+	// Number of tiles which have been fetched on the scanline, not counting
+	// the discarded tile at the start of the scanline.
+	TileX byte
+	// Set once the fetcher has switched to fetching the window.
+	Window bool
+
+	TileNum  byte
+	TileAttr byte
+	DataLo   byte
+	DataHi   byte
+}
+
+// Sprite which was found on the scanline during the OAM scan.
+type lineSprite struct {
+	X, Y     byte
+	Tile     byte
+	Attr     byte
+	OAMIndex byte
+}
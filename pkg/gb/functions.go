@@ -120,11 +120,17 @@ func (gb *Gameboy) instAdd16Signed(set func(uint16), val1 uint16, val2 int8) {
 
 // Perform a 16 bit INC operation on a value ans tore the result using the set function.
 func (gb *Gameboy) instInc16(set func(uint16 uint16), org uint16) {
+	// The register is incremented in an internal cycle
+	gb.tick()
+	gb.triggerOAMBug(org, oamBugWrite)
 	set(org + 1)
 }
 
 // Perform a 16 bit DEC operation on a value ans tore the result using the set function.
 func (gb *Gameboy) instDec16(set func(uint16 uint16), org uint16) {
+	// The register is decremented in an internal cycle
+	gb.tick()
+	gb.triggerOAMBug(org, oamBugWrite)
 	set(org - 1)
 }
 
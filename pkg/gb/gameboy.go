@@ -2,18 +2,40 @@ package gb
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/Humpheh/goboy/pkg/apu"
 	"github.com/Humpheh/goboy/pkg/bits"
+	"github.com/Humpheh/goboy/pkg/cart"
 )
 
 const (
 	// ClockSpeed is the number of cycles the GameBoy CPU performs each second.
 	ClockSpeed = 4194304
-	// FramesSecond is the target number of frames for each frame of GameBoy output.
+	// CyclesFrame is the number of CPU cycles in each frame. Each frame is made
+	// up of 154 scanlines which each take 456 cycles.
+	CyclesFrame = 154 * 456
+	// FramesSecond is the whole number of frames the GameBoy outputs each
+	// second. Use FrameRate for the exact rate.
 	FramesSecond = 60
-	// CyclesFrame is the number of CPU cycles in each frame.
-	CyclesFrame = ClockSpeed / FramesSecond
+	// FrameRate is the exact number of frames the GameBoy outputs each second,
+	// which is roughly 59.73.
+	FrameRate = float64(ClockSpeed) / CyclesFrame
+
+	// Size of the smallest rom which contains a full cartridge header.
+	minROMSize = 0x150
+
+	// Sizes of the DMG and CGB boot ROMs. The CGB boot ROM is mapped over
+	// 0x0000-0x00FF and 0x0200-0x08FF, skipping the cartridge header.
+	dmgBootROMSize = 0x100
+	cgbBootROMSize = 0x900
+
+	// Number of frames between writing the cartridge RAM to the save store.
+	saveInterval = 60
 )
 
 // Gameboy is the master struct which contains all of the sub components
@@ -23,30 +45,41 @@ type Gameboy struct {
 
 	Memory *Memory
 	CPU    *CPU
+	Timer  *Timer
 	Sound  *apu.APU
 
 	Debug  DebugFlags
 	paused bool
 
-	timerCounter int
-
 	// Matrix of pixel data which is used while the screen is rendering. When a
 	// frame has been completed, this data is copied into the PreparedData matrix.
-	screenData [ScreenWidth][ScreenHeight][3]uint8
-	bgPriority [ScreenWidth][ScreenHeight]bool
+	screenData    [ScreenWidth][ScreenHeight][3]uint8
+	screenCleared bool
+
+	// State of the PPU for the scanline it is drawing.
+	ppu ppuState
 
-	// Track colour of tiles in scanline for priority management.
-	tileScanline    [ScreenWidth]uint8
-	scanlineCounter int
-	screenCleared   bool
+	// Set by the PPU when it has finished drawing a frame.
+	frameComplete bool
+	// Number of frames which have been finished, and the cycles which have
+	// been run since the last frame finished
+	frames      int
+	frameCycles int
 
 	// PreparedData is a matrix of screen pixel data for a single frame which has
 	// been fully rendered.
 	PreparedData [ScreenWidth][ScreenHeight][3]uint8
 
+	// Set by EI to enable interrupts once the next instruction has run.
 	interruptsEnabling bool
 	interruptsOn       bool
 	halted             bool
+	// Set by HALT when it fails to halt the CPU. The next opcode is read
+	// without incrementing the PC, so the byte after HALT is read twice.
+	haltBug bool
+	// Set by STOP until a button is pressed. All of the clocks are stopped
+	// while in STOP mode.
+	stopped bool
 
 	mainInst [0x100]func()
 	cbInst   [0x100]func()
@@ -60,41 +93,161 @@ type Gameboy struct {
 	BGPalette     *cgbPalette
 	SpritePalette *cgbPalette
 
+	// Flags for running a DMG game with the CGB boot ROM. The boot ROM selects
+	// the DMG compatibility mode, and once the boot ROM is unmapped the DMG
+	// palette registers select colours from the CGB palettes it has set.
+	dmgCompat      bool
+	compatPalettes bool
+
 	currentSpeed byte
 	prepareSpeed bool
 
 	thisCpuTicks int
+	// Number of cycles which have been ticked by the CPU in the current step.
+	cpuCycles int
+
+	keyHandlers        map[Button]func()
+	keyReleaseHandlers map[Button]func()
 
-	keyHandlers map[Button]func()
+	// Frames since the cartridge RAM was last saved.
+	framesSinceSave int
+
+	// Buffer of snapshots used for rewinding, nil if rewind is not enabled.
+	rewind    *rewindBuffer
+	rewinding bool
 }
 
-// Update update the state of the gameboy by a single frame.
+// Update update the state of the gameboy by a single frame. The frame ends when
+// the PPU enters VBlank, at which point PreparedData contains the full frame. If
+// the LCD is disabled or the Gameboy is in STOP mode then the update ends after
+// the number of cycles a frame would take. Returns the number of cycles which
+// were run.
 func (gb *Gameboy) Update() int {
 	if gb.paused {
 		return 0
 	}
+	if gb.rewinding {
+		if _, err := gb.Rewind(1); err != nil {
+			log.Printf("Error rewinding: %v", err)
+		}
+		return 0
+	}
 
 	cycles := 0
-	for cycles < CyclesFrame*gb.getSpeed() {
-		cyclesOp := 4
-		if !gb.halted {
-			if gb.Debug.OutputOpcodes {
-				LogOpcode(gb, false)
-			}
-			cyclesOp = gb.ExecuteNextOpcode()
-		} else {
-			// TODO: This is incorrect
+	frame := gb.frames
+	for gb.frames == frame {
+		cycles += gb.step()
+	}
+	return cycles
+}
+
+// Finish the current frame, which happens when the PPU enters VBlank or, if
+// the LCD is disabled or the Gameboy is in STOP mode, once the number of
+// cycles a frame would take have passed. The audio of the frame is flushed to
+// the sink, the cartridge RAM is periodically saved and rewind snapshots are
+// taken.
+func (gb *Gameboy) endFrame() {
+	gb.frameComplete = false
+	gb.frameCycles = 0
+	gb.frames++
+	gb.Sound.Flush()
+
+	gb.framesSinceSave++
+	if gb.framesSinceSave >= saveInterval {
+		gb.framesSinceSave = 0
+		if err := gb.Memory.Cart.Save(); err != nil {
+			log.Print(err)
 		}
-		cycles += cyclesOp
-		gb.updateGraphics(cyclesOp)
-		gb.updateTimers(cyclesOp)
-		cycles += gb.doInterrupts()
+	}
 
-		gb.Sound.Buffer(cyclesOp, gb.getSpeed())
+	if gb.rewind != nil {
+		if err := gb.updateRewind(); err != nil {
+			log.Printf("Error taking rewind snapshot: %v", err)
+		}
+	}
+}
+
+// Execute a single instruction and update the rest of the components by the
+// cycles it took, finishing the frame if it has been completed. Returns the
+// number of cycles taken.
+func (gb *Gameboy) step() int {
+	cycles := gb.runInstruction()
+	gb.frameCycles += cycles
+	if gb.frameComplete || ((!gb.isLCDEnabled() || gb.stopped) && gb.frameCycles >= CyclesFrame*gb.getSpeed()) {
+		gb.endFrame()
 	}
 	return cycles
 }
 
+// Execute a single instruction, or wait while halted, and update the rest of
+// the components by the cycles it took. If a GDMA or HDMA has stopped the CPU
+// then the components are updated until it finishes first. Returns the number
+// of cycles taken.
+func (gb *Gameboy) runInstruction() int {
+	if gb.stopped {
+		// Nothing is clocked in STOP mode
+		return 4
+	}
+
+	gb.cpuCycles = 0
+	for gb.Memory.hdmaStall > 0 {
+		// The CPU is stopped while a GDMA or HDMA block is copied
+		gb.Memory.hdmaStall--
+		gb.tick()
+	}
+	if !gb.halted {
+		if gb.Debug.OutputOpcodes {
+			LogOpcode(gb, false)
+		}
+		gb.ExecuteNextOpcode()
+	} else {
+		gb.tick()
+	}
+	gb.doInterrupts()
+	return gb.cpuCycles
+}
+
+// Advance the components other than the CPU by a single machine cycle.
+func (gb *Gameboy) tick() {
+	gb.cpuCycles += 4
+	gb.updateGraphics(4)
+	gb.Timer.Tick(4)
+	gb.Sound.Buffer(4, gb.getSpeed())
+	gb.Memory.tickDMA()
+}
+
+// Read from memory as the CPU, which takes a machine cycle.
+func (gb *Gameboy) cpuRead(address uint16) byte {
+	return gb.cpuReadAccess(address, oamBugRead)
+}
+
+// Read from memory as the CPU while the address is incremented or decremented
+// in the same machine cycle, which corrupts OAM differently to a plain read.
+func (gb *Gameboy) cpuReadIncrement(address uint16) byte {
+	return gb.cpuReadAccess(address, oamBugReadIncrement)
+}
+
+// Read from memory as the CPU with the type of access used for the OAM bug.
+func (gb *Gameboy) cpuReadAccess(address uint16, access oamBugAccess) byte {
+	gb.tick()
+	gb.triggerOAMBug(address, access)
+	if value, conflict := gb.Memory.dmaConflict(address); conflict {
+		return value
+	}
+	return gb.Memory.Read(address)
+}
+
+// Write to memory as the CPU, which takes a machine cycle. Writes which
+// conflict with the OAM DMA are ignored.
+func (gb *Gameboy) cpuWrite(address uint16, value byte) {
+	gb.tick()
+	gb.triggerOAMBug(address, oamBugWrite)
+	if _, conflict := gb.Memory.dmaConflict(address); conflict {
+		return
+	}
+	gb.Memory.Write(address, value)
+}
+
 // togglePaused switches the paused state of the execution.
 func (gb *Gameboy) togglePaused() {
 	gb.paused = !gb.paused
@@ -105,6 +258,53 @@ func (gb *Gameboy) ToggleSoundChannel(channel int) {
 	gb.Sound.ToggleSoundChannel(channel)
 }
 
+// ToggleRecording starts recording the audio to a new WAV file in the working
+// directory, named after the game and the time, or stops the current recording.
+func (gb *Gameboy) ToggleRecording() {
+	if gb.Sound.IsRecording() {
+		if err := gb.StopRecording(); err != nil {
+			log.Printf("Error stopping recording: %v", err)
+			return
+		}
+		log.Print("Stopped recording audio")
+		return
+	}
+
+	var title string
+	if gb.IsGameLoaded() {
+		title = gb.Memory.Cart.GetName()
+	}
+	path := fmt.Sprintf("%s-%s.wav", recordingName(title), time.Now().Format("20060102-150405"))
+	if err := gb.Sound.StartRecording(path, gb.options.recordStems); err != nil {
+		log.Printf("Error starting recording: %v", err)
+		return
+	}
+	log.Printf("Recording audio to %v", path)
+}
+
+// Get a name for a recording file from the title of a game. Any characters
+// which are not safe in a file name, such as path separators, are replaced.
+func recordingName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(title))
+	if strings.Trim(name, "_") == "" {
+		return "goboy"
+	}
+	return name
+}
+
+// StopRecording finishes the current recording of the audio, if there is one.
+// This should be called before the emulator exits so that the WAV files are
+// complete.
+func (gb *Gameboy) StopRecording() error {
+	return gb.Sound.StopRecording()
+}
+
 func (gb *Gameboy) SoundString() {
 	gb.Sound.LogSoundState()
 }
@@ -115,7 +315,7 @@ func (gb *Gameboy) BGMapString() string {
 	for y := uint16(0); y < 0x20; y++ {
 		out += fmt.Sprintf("%2x: ", y)
 		for x := uint16(0); x < 0x20; x++ {
-			out += fmt.Sprintf("%2x ", gb.Memory.Read(0x9800+(y*0x20)+x))
+			out += fmt.Sprintf("%2x ", gb.Memory.VRAM[0x1800+(y*0x20)+x])
 		}
 		out += "\n"
 	}
@@ -131,70 +331,53 @@ func (gb *Gameboy) getSpeed() int {
 	return int(gb.currentSpeed + 1)
 }
 
-// Check if the speed needs to be switched for CGB mode.
-func (gb *Gameboy) checkSpeedSwitch() {
-	if gb.prepareSpeed {
-		// Switch speed
-		gb.prepareSpeed = false
-		if gb.currentSpeed == 0 {
-			gb.currentSpeed = 1
-		} else {
-			gb.currentSpeed = 0
-		}
-		gb.halted = false
+// Check if the speed needs to be switched for CGB mode, and switch the speed if
+// it does. Returns if the speed was switched.
+func (gb *Gameboy) checkSpeedSwitch() bool {
+	if !gb.IsCGB() || !gb.prepareSpeed {
+		return false
 	}
-}
-
-func (gb *Gameboy) updateTimers(cycles int) {
-	gb.dividerRegister(cycles)
-	if gb.isClockEnabled() {
-		gb.timerCounter += cycles
-
-		freq := gb.getClockFreqCount()
-		for gb.timerCounter >= freq {
-			gb.timerCounter -= freq
-			tima := gb.Memory.Read(TIMA)
-			if tima == 0xFF {
-				gb.Memory.HighRAM[TIMA-0xFF00] = gb.Memory.Read(TMA)
-				gb.requestInterrupt(2)
-			} else {
-				gb.Memory.HighRAM[TIMA-0xFF00] = tima + 1
-			}
-		}
+	gb.prepareSpeed = false
+	if gb.currentSpeed == 0 {
+		gb.currentSpeed = 1
+	} else {
+		gb.currentSpeed = 0
 	}
+	return true
 }
 
-func (gb *Gameboy) isClockEnabled() bool {
-	return bits.Test(gb.Memory.Read(TAC), 2)
-}
-
-func (gb *Gameboy) getClockFreq() byte {
-	return gb.Memory.Read(TAC) & 0x3
-}
-
-func (gb *Gameboy) getClockFreqCount() int {
-	switch gb.getClockFreq() {
-	case 0:
-		return 1024
-	case 1:
-		return 16
-	case 2:
-		return 64
-	default:
-		return 256
+// Get the interrupts which are both requested and enabled.
+func (gb *Gameboy) pendingInterrupts() byte {
+	requested := gb.Memory.ReadHighRam(0xFF0F)
+	if gb.Timer.overflowed {
+		// The timer requests its interrupt part way into the machine cycle
+		// after TIMA overflows, which is in time for the CPU to see it
+		requested = bits.Set(requested, 2)
 	}
+	return requested & gb.Memory.ReadHighRam(0xFFFF) & 0x1F
 }
 
-func (gb *Gameboy) setClockFreq() {
-	gb.timerCounter = 0
+// Execute the HALT instruction. The CPU is halted until an interrupt is
+// pending, even if interrupts are disabled. If interrupts are disabled and an
+// interrupt is already pending then the CPU does not halt, and instead fails to
+// increment the PC when reading the next opcode.
+func (gb *Gameboy) halt() {
+	if !gb.interruptsOn && gb.pendingInterrupts() != 0 {
+		gb.haltBug = true
+		return
+	}
+	gb.halted = true
 }
 
-func (gb *Gameboy) dividerRegister(cycles int) {
-	gb.CPU.Divider += cycles
-	if gb.CPU.Divider >= 255 {
-		gb.CPU.Divider -= 255
-		gb.Memory.HighRAM[DIV-0xFF00]++
+// Execute the STOP instruction, which resets the divider and either switches
+// the CPU speed if a switch has been prepared on the CGB, or stops the Gameboy
+// until a button is pressed.
+func (gb *Gameboy) stop() {
+	gb.Timer.Write(DIV, 0)
+	if gb.checkSpeedSwitch() {
+		return
 	}
+	gb.stopped = true
 }
 
 // Request the Gameboy to perform an interrupt.
@@ -204,29 +387,25 @@ func (gb *Gameboy) requestInterrupt(interrupt byte) {
 	gb.Memory.Write(0xFF0F, req)
 }
 
-func (gb *Gameboy) doInterrupts() (cycles int) {
+func (gb *Gameboy) doInterrupts() {
 	if gb.interruptsEnabling {
+		// EI enables interrupts after the instruction following it has
+		// finished, so no interrupt can be serviced between the two
 		gb.interruptsOn = true
 		gb.interruptsEnabling = false
-		return 0
-	}
-	if !gb.interruptsOn && !gb.halted {
-		return 0
+		return
 	}
 
-	req := gb.Memory.ReadHighRam(0xFF0F)
-	enabled := gb.Memory.ReadHighRam(0xFFFF)
-
-	if req > 0 {
-		var i byte
-		for i = 0; i < 5; i++ {
-			if bits.Test(req, i) && bits.Test(enabled, i) {
-				gb.serviceInterrupt(i)
-				return 20
-			}
-		}
+	if gb.pendingInterrupts() == 0 {
+		return
+	}
+	// A pending interrupt always wakes the CPU from HALT, but is only
+	// serviced if interrupts are enabled
+	gb.halted = false
+	if !gb.interruptsOn {
+		return
 	}
-	return 0
+	gb.serviceInterrupt()
 }
 
 // Address that should be jumped to by interrupt.
@@ -238,38 +417,54 @@ var interruptAddresses = map[byte]uint16{
 	4: 0x60, // Hi-Lo P10-P13
 }
 
-// Called if an interrupt has been raised. Will check if interrupts are
-// enabled and will jump to the interrupt address.
-func (gb *Gameboy) serviceInterrupt(interrupt byte) {
-	// If was halted without interrupts, do not jump or reset IF
-	if !gb.interruptsOn && gb.halted {
-		gb.halted = false
-		return
-	}
+// Service the highest priority pending interrupt by pushing the PC to the stack
+// and jumping to the address of the interrupt. This takes 5 machine cycles:
+// 2 wait cycles, 2 cycles to push the PC and a cycle to set the PC.
+//
+// The interrupt to jump to is only chosen after the high byte of the PC has
+// been pushed. If that push overwrites IE and no enabled interrupts are left
+// pending then the dispatch is cancelled and the PC is set to 0x0000 instead.
+func (gb *Gameboy) serviceInterrupt() {
 	gb.interruptsOn = false
-	gb.halted = false
-
-	req := gb.Memory.ReadHighRam(0xFF0F)
-	req = bits.Reset(req, interrupt)
-	gb.Memory.Write(0xFF0F, req)
+	gb.tick()
+	gb.tick()
 
-	gb.pushStack(gb.CPU.PC)
-	gb.CPU.PC = interruptAddresses[interrupt]
+	sp := gb.CPU.SP.HiLo()
+	gb.cpuWrite(sp-1, byte(gb.CPU.PC>>8))
+	pending := gb.pendingInterrupts()
+	gb.cpuWrite(sp-2, byte(gb.CPU.PC&0xFF))
+	gb.CPU.SP.Set(sp - 2)
+
+	gb.CPU.PC = 0x0000
+	var i byte
+	for i = 0; i < 5; i++ {
+		// Lower interrupt bits have a higher priority
+		if bits.Test(pending, i) {
+			req := gb.Memory.ReadHighRam(0xFF0F)
+			gb.Memory.Write(0xFF0F, bits.Reset(req, i))
+			gb.CPU.PC = interruptAddresses[i]
+			break
+		}
+	}
+	gb.tick()
 }
 
 // Push a 16 bit value onto the stack and decrement SP.
 func (gb *Gameboy) pushStack(address uint16) {
+	// There is an internal cycle to decrement SP before the writes
+	gb.tick()
 	sp := gb.CPU.SP.HiLo()
-	gb.Memory.Write(sp-1, byte(uint16(address&0xFF00)>>8))
-	gb.Memory.Write(sp-2, byte(address&0xFF))
+	gb.triggerOAMBug(sp, oamBugWrite)
+	gb.cpuWrite(sp-1, byte(uint16(address&0xFF00)>>8))
+	gb.cpuWrite(sp-2, byte(address&0xFF))
 	gb.CPU.SP.Set(gb.CPU.SP.HiLo() - 2)
 }
 
 // Pop the next 16 bit value off the stack and increment SP.
 func (gb *Gameboy) popStack() uint16 {
 	sp := gb.CPU.SP.HiLo()
-	byte1 := uint16(gb.Memory.Read(sp))
-	byte2 := uint16(gb.Memory.Read(sp+1)) << 8
+	byte1 := uint16(gb.cpuReadIncrement(sp))
+	byte2 := uint16(gb.cpuReadIncrement(sp+1)) << 8
 	gb.CPU.SP.Set(gb.CPU.SP.HiLo() + 2)
 	return byte1 | byte2
 }
@@ -284,26 +479,68 @@ func (gb *Gameboy) joypadValue(current byte) byte {
 	return current | 0xc0 | in
 }
 
+// Flush writes any unsaved changes to the cartridge RAM to the save store. This
+// should be called before the emulator exits so that no save data is lost.
+func (gb *Gameboy) Flush() error {
+	if !gb.IsGameLoaded() {
+		return nil
+	}
+	return gb.Memory.Cart.Save()
+}
+
 // IsGameLoaded returns if there is a game loaded in the gameboy or not.
 func (gb *Gameboy) IsGameLoaded() bool {
 	return gb.Memory != nil && gb.Memory.Cart != nil
 }
 
+// Model returns the hardware model being emulated.
+func (gb *Gameboy) Model() Model {
+	return gb.options.model
+}
+
 // IsCGB returns if we are using CGB features.
 func (gb *Gameboy) IsCGB() bool {
 	return gb.cgbMode
 }
 
-// Initialise the Gameboy using a path to a rom.
-func (gb *Gameboy) init(romFile string) error {
+// Initialise the Gameboy using the data of a rom. The name is used as the
+// key for the save data of the game.
+func (gb *Gameboy) init(rom []byte, name string, store cart.SaveStore) error {
+	if len(rom) < minROMSize {
+		return fmt.Errorf("rom is too small: %v bytes", len(rom))
+	}
+	bootROM := gb.options.bootROM
+	if bootROM != nil && len(bootROM) != dmgBootROMSize && len(bootROM) != cgbBootROMSize {
+		return fmt.Errorf("boot rom must be %v or %v bytes: %v bytes", dmgBootROMSize, cgbBootROMSize, len(bootROM))
+	}
+	if bootROM != nil && gb.options.model.IsCGB() != (len(bootROM) == cgbBootROMSize) {
+		// The boot ROM determines the hardware
+		if len(bootROM) == cgbBootROMSize {
+			gb.options.model = ModelCGB
+		} else {
+			gb.options.model = ModelDMG
+		}
+	}
+	if err := gb.options.openSoundSink(); err != nil {
+		return fmt.Errorf("failed to start audio: %v", err)
+	}
 	gb.setup()
 
-	// Load the ROM file
-	hasCGB, err := gb.Memory.LoadCart(romFile)
-	if err != nil {
-		return fmt.Errorf("failed to open rom file: %s", err)
+	hasCGB := gb.Memory.LoadCart(cart.NewCartWithStore(rom, name, store))
+	if bootROM != nil {
+		// The CGB boot ROM will select the DMG compatibility mode if the
+		// game does not support CGB.
+		gb.cgbMode = gb.options.model.IsCGB()
+	} else {
+		gb.cgbMode = gb.options.model.IsCGB() && hasCGB
+		gb.CPU.Init(gb.options.model, hasCGB)
+	}
+
+	if gb.options.recordPath != "" {
+		if err := gb.Sound.StartRecording(gb.options.recordPath, gb.options.recordStems); err != nil {
+			return fmt.Errorf("failed to start recording: %v", err)
+		}
 	}
-	gb.cgbMode = gb.options.cgbMode && hasCGB
 	return nil
 }
 
@@ -319,6 +556,11 @@ func (gb *Gameboy) initKeyHandlers() {
 		ButtonToggleSoundChannel2: func() { gb.ToggleSoundChannel(2) },
 		ButtonToggleSoundChannel3: func() { gb.ToggleSoundChannel(3) },
 		ButtonToggleSoundChannel4: func() { gb.ToggleSoundChannel(4) },
+		ButtonRewind:              gb.startRewinding,
+		ButtonToggleRecording:     gb.ToggleRecording,
+	}
+	gb.keyReleaseHandlers = map[Button]func(){
+		ButtonRewind: gb.stopRewinding,
 	}
 }
 
@@ -326,17 +568,22 @@ func (gb *Gameboy) initKeyHandlers() {
 func (gb *Gameboy) setup() {
 	// Initialise the CPU
 	gb.CPU = &CPU{}
-	gb.CPU.Init(gb.options.cgbMode)
+	if gb.options.bootROM != nil {
+		gb.CPU.InitBoot()
+	}
+
+	// The sound registers are set by the memory to their post-boot values
+	gb.Sound = &apu.APU{}
+	gb.Sound.Init(gb.options.audioSink, gb.options.model.IsCGB())
 
 	// Initialise the memory
 	gb.Memory = &Memory{}
 	gb.Memory.Init(gb)
 
-	gb.Sound = &apu.APU{}
-	gb.Sound.Init(gb.options.sound)
+	gb.Timer = &Timer{}
+	gb.Timer.Init(gb)
 
 	gb.Debug = DebugFlags{}
-	gb.scanlineCounter = 456
 	gb.inputMask = 0xFF
 
 	gb.mainInst = gb.mainInstructions()
@@ -345,19 +592,63 @@ func (gb *Gameboy) setup() {
 	gb.SpritePalette = NewPalette()
 	gb.BGPalette = NewPalette()
 
+	if gb.options.rewindBytes > 0 {
+		gb.rewind = newRewindBuffer(gb.options.rewindInterval, gb.options.rewindBytes)
+	}
+
 	gb.initKeyHandlers()
 }
 
-// NewGameboy returns a new Gameboy instance.
+// NewGameboy returns a new Gameboy instance running a rom file. Unless another
+// store is provided with the WithSaveStore option, save data will be stored in
+// a file next to the rom.
 func NewGameboy(romFile string, opts ...GameboyOption) (*Gameboy, error) {
-	// Build the gameboy
+	rom, err := cart.LoadROMFile(romFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rom file: %s", err)
+	}
+	gameboy := newGameboy(opts)
+	store := gameboy.options.saveStore
+	if store == nil {
+		store = cart.FileSaveStore{}
+	}
+	err = gameboy.init(rom, romFile, store)
+	if err != nil {
+		return nil, err
+	}
+	return gameboy, nil
+}
+
+// NewGameboyFromROM returns a new Gameboy instance running a rom from its data.
+// The game will only be saved if a store is provided with the WithSaveStore option,
+// and the save data is stored using the title of the cartridge.
+func NewGameboyFromROM(rom []byte, opts ...GameboyOption) (*Gameboy, error) {
+	gameboy := newGameboy(opts)
+	err := gameboy.init(rom, "", gameboy.options.saveStore)
+	if err != nil {
+		return nil, err
+	}
+	return gameboy, nil
+}
+
+// NewGameboyFromReader returns a new Gameboy instance running a rom which is read
+// from the reader. See NewGameboyFromROM.
+func NewGameboyFromReader(r io.Reader, opts ...GameboyOption) (*Gameboy, error) {
+	rom, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rom: %s", err)
+	}
+	return NewGameboyFromROM(rom, opts...)
+}
+
+// Build a Gameboy with the options applied.
+func newGameboy(opts []GameboyOption) *Gameboy {
 	gameboy := Gameboy{}
 	for _, opt := range opts {
 		opt(&gameboy.options)
 	}
-	err := gameboy.init(romFile)
-	if err != nil {
-		return nil, err
+	if gameboy.options.model == ModelDefault {
+		gameboy.options.model = ModelDMG
 	}
-	return &gameboy, nil
+	return &gameboy
 }
@@ -0,0 +1,52 @@
+package gb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewGameboyFromReader asserts that a rom can be run from a reader.
+func TestNewGameboyFromReader(t *testing.T) {
+	file, err := os.Open("./../../roms/blargg/instr_timing.gb")
+	require.NoError(t, err)
+	defer file.Close()
+
+	output := ""
+	gb, err := NewGameboyFromReader(file, WithTransferFunction(func(val byte) {
+		output += string(val)
+	}))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	for i := 0; i < 100; i++ {
+		gb.Update()
+	}
+	assert.Contains(t, output, "instr_timing")
+}
+
+// TestNewGameboyFromROM_TooSmall asserts that an error is returned for a rom
+// which does not contain a cartridge header.
+func TestNewGameboyFromROM_TooSmall(t *testing.T) {
+	_, err := NewGameboyFromROM(make([]byte, 0x100))
+	assert.Error(t, err)
+}
+
+// TestUpdate_FrameAlignment asserts that each frame ends at the start of VBlank
+// and takes the number of cycles the PPU takes to draw a frame.
+func TestUpdate_FrameAlignment(t *testing.T) {
+	gb, err := NewGameboy("./../../roms/mooneye/runnable/sprite_priority.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+	for i := 0; i < 10; i++ {
+		gb.Update()
+	}
+
+	cycles := 0
+	const frames = 10
+	for i := 0; i < frames; i++ {
+		cycles += gb.Update()
+		assert.Equal(t, byte(ScreenHeight), gb.Memory.ReadHighRam(0xFF44), "frame did not end on vblank")
+	}
+	assert.InDelta(t, frames*CyclesFrame, cycles, 24, "unexpected number of cycles in frames")
+}
@@ -0,0 +1,98 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a rom which runs a program from the entry point.
+func programROM(program ...byte) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], program)
+	return rom
+}
+
+// TestHalt_Bug asserts that HALT with interrupts disabled and an interrupt
+// pending does not halt, and that the byte after HALT is executed twice.
+func TestHalt_Bug(t *testing.T) {
+	gb, err := NewGameboyFromROM(programROM(
+		0xF3,       // DI
+		0x06, 0x00, // LD B,0
+		0x3E, 0x04, // LD A,4
+		0xE0, 0xFF, // LDH (IE),A
+		0xE0, 0x0F, // LDH (IF),A
+		0x76,       // HALT
+		0x04,       // INC B
+		0x18, 0xFE, // JR -2
+	))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	gb.RunUntil(func(gb *Gameboy) bool { return gb.CPU.PC == 0x10B })
+	assert.False(t, gb.halted, "cpu should not halt")
+	assert.Equal(t, byte(2), gb.CPU.BC.Hi(), "instruction after halt should run twice")
+}
+
+// TestHalt_WakeWithoutIME asserts that HALT with interrupts disabled wakes the
+// CPU once an interrupt is requested, without servicing the interrupt.
+func TestHalt_WakeWithoutIME(t *testing.T) {
+	gb, err := NewGameboyFromROM(programROM(
+		0xF3,       // DI
+		0x3E, 0x04, // LD A,4
+		0xE0, 0xFF, // LDH (IE),A
+		0xAF,       // XOR A
+		0xE0, 0x0F, // LDH (IF),A
+		0x3E, 0x05, // LD A,5
+		0xE0, 0x07, // LDH (TAC),A
+		0x76,       // HALT
+		0x18, 0xFE, // JR -2
+	))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	gb.RunUntil(func(gb *Gameboy) bool { return gb.halted })
+	gb.RunUntil(func(gb *Gameboy) bool { return !gb.halted })
+	assert.Equal(t, uint16(0x10D), gb.CPU.PC, "should continue after halt")
+	assert.Equal(t, byte(0x04), gb.pendingInterrupts(), "interrupt should not be serviced")
+}
+
+// TestStop asserts that STOP stops the Gameboy until a button is pressed.
+func TestStop(t *testing.T) {
+	gb, err := NewGameboyFromROM(programROM(
+		0x10, 0x00, // STOP
+		0x18, 0xFE, // JR -2
+	))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	gb.StepInstruction()
+	assert.True(t, gb.stopped)
+	assert.Equal(t, byte(0), gb.Memory.Read(DIV), "stop should reset the divider")
+
+	gb.Update()
+	assert.Equal(t, uint16(0x102), gb.CPU.PC, "cpu should not run while stopped")
+
+	gb.ProcessInput(ButtonInput{Pressed: []Button{ButtonStart}})
+	gb.StepInstruction()
+	assert.False(t, gb.stopped)
+	assert.Equal(t, uint16(0x102), gb.CPU.PC)
+}
+
+// TestStop_SpeedSwitch asserts that STOP switches the CPU speed on the CGB
+// when a switch has been prepared.
+func TestStop_SpeedSwitch(t *testing.T) {
+	rom := programROM(
+		0x3E, 0x01, // LD A,1
+		0xE0, 0x4D, // LDH (KEY1),A
+		0x10, 0x00, // STOP
+		0x18, 0xFE, // JR -2
+	)
+	rom[0x143] = 0x80
+
+	gb, err := NewGameboyFromROM(rom, WithModel(ModelCGB))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	gb.RunUntil(func(gb *Gameboy) bool { return gb.CPU.PC == 0x106 })
+	assert.False(t, gb.stopped, "speed switch should not stop the cpu")
+	assert.Equal(t, 2, gb.getSpeed())
+	assert.Equal(t, byte(0x80), gb.Memory.Read(0xFF4D))
+}
@@ -0,0 +1,61 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a CGB Gameboy which starts a GDMA or HDMA of 16 byte blocks from
+// 0xC000 to 0x8000 with the value written to HDMA5.
+func hdmaGameboy(t *testing.T, hdma5 byte) *Gameboy {
+	rom := programROM(
+		0x3E, 0xC0, // LD A,0xC0
+		0xE0, 0x51, // LDH (HDMA1),A
+		0xAF,       // XOR A
+		0xE0, 0x52, // LDH (HDMA2),A
+		0xE0, 0x53, // LDH (HDMA3),A
+		0xE0, 0x54, // LDH (HDMA4),A
+		0x3E, hdma5, // LD A,hdma5
+		0xE0, 0x55, // LDH (HDMA5),A
+		0x18, 0xFE, // JR -2
+	)
+	rom[0x143] = 0x80
+
+	gb, err := NewGameboyFromROM(rom, WithModel(ModelCGB))
+	require.NoError(t, err, "error in init gb %v", err)
+	for i := 0; i < 0x40; i++ {
+		gb.Memory.WRAM[i] = byte(i + 1)
+	}
+	gb.RunUntil(func(gb *Gameboy) bool { return gb.CPU.PC == 0x10F })
+	return gb
+}
+
+// TestHDMA_GeneralPurpose asserts that a GDMA copies all of the blocks and
+// stops the CPU for 8 M-cycles per block.
+func TestHDMA_GeneralPurpose(t *testing.T) {
+	gb := hdmaGameboy(t, 0x01)
+	assert.Equal(t, gb.Memory.WRAM[:0x20], gb.Memory.VRAM[:0x20])
+	assert.Equal(t, byte(0), gb.Memory.VRAM[0x20])
+	assert.Equal(t, byte(0xFF), gb.Memory.Read(0xFF55))
+
+	// The JR after the transfer takes 3 M-cycles
+	assert.Equal(t, (2*8+3)*4, gb.StepInstruction())
+}
+
+// TestHDMA_HBlank asserts that a HDMA copies a block each HBlank, and that the
+// remaining length can be read while it is active and after it is aborted.
+func TestHDMA_HBlank(t *testing.T) {
+	gb := hdmaGameboy(t, 0x82)
+	assert.Equal(t, byte(0), gb.Memory.Read(0xFF55)&0x80, "hdma should be active")
+
+	gb.RunUntil(func(gb *Gameboy) bool { return gb.Memory.Read(0xFF55) == 0x00 })
+	assert.Equal(t, gb.Memory.WRAM[:0x20], gb.Memory.VRAM[:0x20])
+	assert.Equal(t, byte(0), gb.Memory.VRAM[0x20], "last block should not be copied")
+
+	gb.Memory.Write(0xFF55, 0x00)
+	assert.Equal(t, byte(0x80), gb.Memory.Read(0xFF55))
+	gb.RunCycles(CyclesFrame)
+	assert.Equal(t, byte(0), gb.Memory.VRAM[0x20], "aborted hdma should not copy")
+}
@@ -35,6 +35,8 @@ const (
 	ButtonToggleSoundChannel2 = 15
 	ButtonToggleSoundChannel3 = 16
 	ButtonToggleSoundChannel4 = 17
+	ButtonRewind              = 18
+	ButtonToggleRecording     = 19
 )
 
 // IsGameBoyInput checks whether a button value represents a physical button on a gameboy
@@ -69,6 +71,9 @@ func (gb *Gameboy) pressButton(button Button) {
 
 	gb.inputMask = bits.Reset(gb.inputMask, byte(button))
 	gb.requestInterrupt(4) // Request the joypad interrupt
+
+	// Pressing a button wakes the Gameboy from STOP mode
+	gb.stopped = false
 }
 
 // releaseButton notifies the GameBoy that a button has just been released.
@@ -93,6 +98,8 @@ func (gb *Gameboy) ProcessInput(buttons ButtonInput) {
 	for _, button := range buttons.Released {
 		if button.IsGameBoyButton() {
 			gb.releaseButton(button)
+		} else if handler, ok := gb.keyReleaseHandlers[button]; ok {
+			handler()
 		}
 	}
 }
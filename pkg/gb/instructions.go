@@ -43,17 +43,31 @@ var CBOpcodeCycles = []int{
 } //0  1  2  3  4  5  6  7  8  9  a  b  c  d  e  f
 
 // ExecuteNextOpcode gets the value at the current PC address, increments the PC,
-// updates the CPU ticks and executes the opcode.
+// updates the CPU ticks and executes the opcode. The rest of the Gameboy is
+// advanced a machine cycle at a time as the instruction accesses memory, and
+// returns the number of cycles the instruction took.
 func (gb *Gameboy) ExecuteNextOpcode() int {
+	start := gb.cpuCycles
 	opcode := gb.popPC()
+	if gb.haltBug {
+		// The HALT bug causes the PC to not be incremented
+		gb.haltBug = false
+		gb.CPU.PC--
+	}
 	gb.thisCpuTicks = OpcodeCycles[opcode] * 4
 	gb.mainInst[opcode]()
-	return gb.thisCpuTicks
+
+	// Any internal cycles of the instruction which have not already been
+	// ticked happen after its last memory access
+	for gb.cpuCycles-start < gb.thisCpuTicks {
+		gb.tick()
+	}
+	return gb.cpuCycles - start
 }
 
 // Read the value at the PC and increment the PC.
 func (gb *Gameboy) popPC() byte {
-	opcode := gb.Memory.Read(gb.CPU.PC)
+	opcode := gb.cpuRead(gb.CPU.PC)
 	gb.CPU.PC++
 	return opcode
 }
@@ -127,22 +141,22 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x0A: func() {
 			// LD A,(BC)
-			val := gb.Memory.Read(gb.CPU.BC.HiLo())
+			val := gb.cpuRead(gb.CPU.BC.HiLo())
 			gb.CPU.AF.SetHi(val)
 		},
 		0x1A: func() {
 			// LD A,(DE)
-			val := gb.Memory.Read(gb.CPU.DE.HiLo())
+			val := gb.cpuRead(gb.CPU.DE.HiLo())
 			gb.CPU.AF.SetHi(val)
 		},
 		0x7E: func() {
 			// LD A,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuRead(gb.CPU.HL.HiLo())
 			gb.CPU.AF.SetHi(val)
 		},
 		0xFA: func() {
 			// LD A,(nn)
-			val := gb.Memory.Read(gb.popPC16())
+			val := gb.cpuRead(gb.popPC16())
 			gb.CPU.AF.SetHi(val)
 		},
 		0x3E: func() {
@@ -180,7 +194,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x46: func() {
 			// LD B,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuRead(gb.CPU.HL.HiLo())
 			gb.CPU.BC.SetHi(val)
 		},
 		0x4F: func() {
@@ -213,7 +227,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x4E: func() {
 			// LD C,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuRead(gb.CPU.HL.HiLo())
 			gb.CPU.BC.SetLo(val)
 		},
 		0x57: func() {
@@ -246,7 +260,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x56: func() {
 			// LD D,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuRead(gb.CPU.HL.HiLo())
 			gb.CPU.DE.SetHi(val)
 		},
 		0x5F: func() {
@@ -279,7 +293,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x5E: func() {
 			// LD E,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuRead(gb.CPU.HL.HiLo())
 			gb.CPU.DE.SetLo(val)
 		},
 		0x67: func() {
@@ -312,7 +326,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x66: func() {
 			// LD H,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuRead(gb.CPU.HL.HiLo())
 			gb.CPU.HL.SetHi(val)
 		},
 		0x6F: func() {
@@ -345,107 +359,107 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x6E: func() {
 			// LD L,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuRead(gb.CPU.HL.HiLo())
 			gb.CPU.HL.SetLo(val)
 		},
 		0x77: func() {
 			// LD (HL),A
 			val := gb.CPU.AF.Hi()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x70: func() {
 			// LD (HL),B
 			val := gb.CPU.BC.Hi()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x71: func() {
 			// LD (HL),C
 			val := gb.CPU.BC.Lo()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x72: func() {
 			// LD (HL),D
 			val := gb.CPU.DE.Hi()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x73: func() {
 			// LD (HL),E
 			val := gb.CPU.DE.Lo()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x74: func() {
 			// LD (HL),H
 			val := gb.CPU.HL.Hi()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x75: func() {
 			// LD (HL),L
 			val := gb.CPU.HL.Lo()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x36: func() {
 			// LD (HL),n 36
 			val := gb.popPC()
-			gb.Memory.Write(gb.CPU.HL.HiLo(), val)
+			gb.cpuWrite(gb.CPU.HL.HiLo(), val)
 		},
 		0x02: func() {
 			// LD (BC),A
 			val := gb.CPU.AF.Hi()
-			gb.Memory.Write(gb.CPU.BC.HiLo(), val)
+			gb.cpuWrite(gb.CPU.BC.HiLo(), val)
 		},
 		0x12: func() {
 			// LD (DE),A
 			val := gb.CPU.AF.Hi()
-			gb.Memory.Write(gb.CPU.DE.HiLo(), val)
+			gb.cpuWrite(gb.CPU.DE.HiLo(), val)
 		},
 		0xEA: func() {
 			// LD (nn),A
 			val := gb.CPU.AF.Hi()
-			gb.Memory.Write(gb.popPC16(), val)
+			gb.cpuWrite(gb.popPC16(), val)
 		},
 		0xF2: func() {
 			// LD A,(C)
 			val := 0xFF00 + uint16(gb.CPU.BC.Lo())
-			gb.CPU.AF.SetHi(gb.Memory.Read(val))
+			gb.CPU.AF.SetHi(gb.cpuRead(val))
 		},
 		0xE2: func() {
 			// LD (C),A
 			val := gb.CPU.AF.Hi()
 			mem := 0xFF00 + uint16(gb.CPU.BC.Lo())
-			gb.Memory.Write(mem, val)
+			gb.cpuWrite(mem, val)
 		},
 		0x3A: func() {
 			// LDD A,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuReadIncrement(gb.CPU.HL.HiLo())
 			gb.CPU.AF.SetHi(val)
 			gb.CPU.HL.Set(gb.CPU.HL.HiLo() - 1)
 		},
 		0x32: func() {
 			// LDD (HL),A
 			val := gb.CPU.HL.HiLo()
-			gb.Memory.Write(val, gb.CPU.AF.Hi())
+			gb.cpuWrite(val, gb.CPU.AF.Hi())
 			gb.CPU.HL.Set(gb.CPU.HL.HiLo() - 1)
 		},
 		0x2A: func() {
 			// LDI A,(HL)
-			val := gb.Memory.Read(gb.CPU.HL.HiLo())
+			val := gb.cpuReadIncrement(gb.CPU.HL.HiLo())
 			gb.CPU.AF.SetHi(val)
 			gb.CPU.HL.Set(gb.CPU.HL.HiLo() + 1)
 		},
 		0x22: func() {
 			// LDI (HL),A
 			val := gb.CPU.HL.HiLo()
-			gb.Memory.Write(val, gb.CPU.AF.Hi())
+			gb.cpuWrite(val, gb.CPU.AF.Hi())
 			gb.CPU.HL.Set(gb.CPU.HL.HiLo() + 1)
 		},
 		0xE0: func() {
 			// LD (0xFF00+n),A
 			val := 0xFF00 + uint16(gb.popPC())
-			gb.Memory.Write(val, gb.CPU.AF.Hi())
+			gb.cpuWrite(val, gb.CPU.AF.Hi())
 		},
 		0xF0: func() {
 			// LD A,(0xFF00+n)
-			val := gb.Memory.ReadHighRam(0xFF00 + uint16(gb.popPC()))
+			val := gb.cpuRead(0xFF00 + uint16(gb.popPC()))
 			gb.CPU.AF.SetHi(val)
 		},
 		// ========== 16-Bit Loads ===========
@@ -481,8 +495,8 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		0x08: func() {
 			// LD (nn),SP
 			address := gb.popPC16()
-			gb.Memory.Write(address, gb.CPU.SP.Lo())
-			gb.Memory.Write(address+1, gb.CPU.SP.Hi())
+			gb.cpuWrite(address, gb.CPU.SP.Lo())
+			gb.cpuWrite(address+1, gb.CPU.SP.Hi())
 		},
 		0xF5: func() {
 			// PUSH AF
@@ -547,7 +561,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x86: func() {
 			// ADD A,(HL)
-			gb.instAdd(gb.CPU.AF.SetHi, gb.Memory.Read(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi(), false)
+			gb.instAdd(gb.CPU.AF.SetHi, gb.cpuRead(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi(), false)
 		},
 		0xC6: func() {
 			// ADD A,#
@@ -583,7 +597,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x8E: func() {
 			// ADC A,(HL)
-			gb.instAdd(gb.CPU.AF.SetHi, gb.Memory.Read(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi(), true)
+			gb.instAdd(gb.CPU.AF.SetHi, gb.cpuRead(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi(), true)
 		},
 		0xCE: func() {
 			// ADC A,#
@@ -619,7 +633,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x96: func() {
 			// SUB A,(HL)
-			gb.instSub(gb.CPU.AF.SetHi, gb.CPU.AF.Hi(), gb.Memory.Read(gb.CPU.HL.HiLo()), false)
+			gb.instSub(gb.CPU.AF.SetHi, gb.CPU.AF.Hi(), gb.cpuRead(gb.CPU.HL.HiLo()), false)
 		},
 		0xD6: func() {
 			// SUB A,#
@@ -655,7 +669,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x9E: func() {
 			// SBC A,(HL)
-			gb.instSub(gb.CPU.AF.SetHi, gb.CPU.AF.Hi(), gb.Memory.Read(gb.CPU.HL.HiLo()), true)
+			gb.instSub(gb.CPU.AF.SetHi, gb.CPU.AF.Hi(), gb.cpuRead(gb.CPU.HL.HiLo()), true)
 		},
 		0xDE: func() {
 			// SBC A,#
@@ -691,7 +705,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xA6: func() {
 			// AND A,(HL)
-			gb.instAnd(gb.CPU.AF.SetHi, gb.Memory.Read(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
+			gb.instAnd(gb.CPU.AF.SetHi, gb.cpuRead(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
 		},
 		0xE6: func() {
 			// AND A,#
@@ -727,7 +741,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xB6: func() {
 			// OR A,(HL)
-			gb.instOr(gb.CPU.AF.SetHi, gb.Memory.Read(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
+			gb.instOr(gb.CPU.AF.SetHi, gb.cpuRead(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
 		},
 		0xF6: func() {
 			// OR A,#
@@ -763,7 +777,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xAE: func() {
 			// XOR A,(HL)
-			gb.instXor(gb.CPU.AF.SetHi, gb.Memory.Read(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
+			gb.instXor(gb.CPU.AF.SetHi, gb.cpuRead(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
 		},
 		0xEE: func() {
 			// XOR A,#
@@ -799,7 +813,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xBE: func() {
 			// CP A,(HL)
-			gb.instCp(gb.Memory.Read(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
+			gb.instCp(gb.cpuRead(gb.CPU.HL.HiLo()), gb.CPU.AF.Hi())
 		},
 		0xFE: func() {
 			// CP A,#
@@ -836,7 +850,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		0x34: func() {
 			// INC (HL)
 			addr := gb.CPU.HL.HiLo()
-			gb.instInc(func(val byte) { gb.Memory.Write(addr, val) }, gb.Memory.Read(addr))
+			gb.instInc(func(val byte) { gb.cpuWrite(addr, val) }, gb.cpuRead(addr))
 		},
 		0x3D: func() {
 			// DEC A
@@ -869,7 +883,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		0x35: func() {
 			// DEC (HL)
 			addr := gb.CPU.HL.HiLo()
-			gb.instDec(func(val byte) { gb.Memory.Write(addr, val) }, gb.Memory.Read(addr))
+			gb.instDec(func(val byte) { gb.cpuWrite(addr, val) }, gb.cpuRead(addr))
 		},
 		// ========== 16-Bit ALU ===========
 		0x09: func() {
@@ -979,20 +993,15 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0x76: func() {
 			// HALT
-			gb.halted = true
+			gb.halt()
 		},
 		0x10: func() {
 			// STOP
-			gb.halted = true
-			if gb.IsCGB() {
-				// Handle switching to double speed mode
-				gb.checkSpeedSwitch()
-			}
-
 			// Pop the next value as the STOP instruction is 2 bytes long. The second value
 			// can be ignored, although generally it is expected to be 0x00 and any other
 			// value is counted as a corrupted STOP instruction.
 			gb.popPC()
+			gb.stop()
 		},
 		0xF3: func() {
 			// DI
@@ -1000,7 +1009,9 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xFB: func() {
 			// EI
-			gb.interruptsEnabling = true
+			// If interrupts are already enabled there is no delay, so an
+			// interrupt can be serviced straight after a repeated EI
+			gb.interruptsEnabling = !gb.interruptsOn
 		},
 		0x07: func() {
 			// RLCA
@@ -1205,6 +1216,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xC0: func() {
 			// RET NZ
+			gb.tick()
 			if !gb.CPU.Z() {
 				gb.instRet()
 				gb.thisCpuTicks += 12
@@ -1212,6 +1224,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xC8: func() {
 			// RET Z
+			gb.tick()
 			if gb.CPU.Z() {
 				gb.instRet()
 				gb.thisCpuTicks += 12
@@ -1219,6 +1232,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xD0: func() {
 			// RET NC
+			gb.tick()
 			if !gb.CPU.C() {
 				gb.instRet()
 				gb.thisCpuTicks += 12
@@ -1226,6 +1240,7 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xD8: func() {
 			// RET C
+			gb.tick()
 			if gb.CPU.C() {
 				gb.instRet()
 				gb.thisCpuTicks += 12
@@ -1233,8 +1248,9 @@ func (gb *Gameboy) mainInstructions() [0x100]func() {
 		},
 		0xD9: func() {
 			// RETI
+			// Unlike EI, interrupts are enabled without a delay
 			gb.instRet()
-			gb.interruptsEnabling = true
+			gb.interruptsOn = true
 		},
 		0xCB: func() {
 			// CB
@@ -108,7 +108,7 @@ func (gb *Gameboy) cbInstructions() [0x100]func() {
 		gb.CPU.DE.Lo,
 		gb.CPU.HL.Hi,
 		gb.CPU.HL.Lo,
-		func() byte { return gb.Memory.Read(gb.CPU.HL.HiLo()) },
+		func() byte { return gb.cpuRead(gb.CPU.HL.HiLo()) },
 		gb.CPU.AF.Hi,
 	}
 	setMap := [8]func(byte){
@@ -118,7 +118,7 @@ func (gb *Gameboy) cbInstructions() [0x100]func() {
 		gb.CPU.DE.SetLo,
 		gb.CPU.HL.SetHi,
 		gb.CPU.HL.SetLo,
-		func(v byte) { gb.Memory.Write(gb.CPU.HL.HiLo(), v) },
+		func(v byte) { gb.cpuWrite(gb.CPU.HL.HiLo(), v) },
 		gb.CPU.AF.SetHi,
 	}
 
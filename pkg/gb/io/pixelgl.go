@@ -132,6 +132,8 @@ var keyMap = map[pixelgl.Button]gb.Button{
 	pixelgl.Key8:      gb.ButtonToggleSoundChannel2,
 	pixelgl.Key9:      gb.ButtonToggleSoundChannel3,
 	pixelgl.Key0:      gb.ButtonToggleSoundChannel4,
+	pixelgl.KeyR:      gb.ButtonRewind,
+	pixelgl.KeyC:      gb.ButtonToggleRecording,
 }
 
 // ProcessInput checks the input and process it.
@@ -45,36 +45,39 @@ type Memory struct {
 	// CGB HDMA transfer variables
 	hdmaLength byte
 	hdmaActive bool
+	// Number of M-cycles the CPU is stopped for while a GDMA or HDMA copies
+	// data to VRAM.
+	hdmaStall int
+
+	// OAM DMA transfer variables. A transfer which has been requested waits
+	// for dmaStarting M-cycles before replacing the active transfer.
+	dmaActive      bool
+	dmaSource      uint16
+	dmaIndex       uint16
+	dmaValue       byte
+	dmaStarting    int
+	dmaStartSource uint16
+
+	// Boot ROM which is mapped over the cartridge ROM until it is
+	// unmapped by a write to 0xFF50.
+	bootROM        []byte
+	bootROMEnabled bool
 }
 
-// Init the gb memory to the post-boot values.
+// Init the gb memory to the post-boot values. If a boot ROM is being used then
+// the memory is left in the power on state for the boot ROM to initialise.
 func (mem *Memory) Init(gameboy *Gameboy) {
 	mem.gb = gameboy
+	mem.WRAMBank = 1
+
+	if gameboy.options.bootROM != nil {
+		mem.bootROM = gameboy.options.bootROM
+		mem.bootROMEnabled = true
+		return
+	}
 
 	// Set the default values
-	mem.HighRAM[0x04] = 0x1E
-	mem.HighRAM[0x05] = 0x00
-	mem.HighRAM[0x06] = 0x00
-	mem.HighRAM[0x07] = 0xF8
 	mem.HighRAM[0x0F] = 0xE1
-	mem.HighRAM[0x10] = 0x80
-	mem.HighRAM[0x11] = 0xBF
-	mem.HighRAM[0x12] = 0xF3
-	mem.HighRAM[0x14] = 0xBF
-	mem.HighRAM[0x16] = 0x3F
-	mem.HighRAM[0x17] = 0x00
-	mem.HighRAM[0x19] = 0xBF
-	mem.HighRAM[0x1A] = 0x7F
-	mem.HighRAM[0x1B] = 0xFF
-	mem.HighRAM[0x1C] = 0x9F
-	mem.HighRAM[0x1E] = 0xBF
-	mem.HighRAM[0x20] = 0xFF
-	mem.HighRAM[0x21] = 0x00
-	mem.HighRAM[0x22] = 0x00
-	mem.HighRAM[0x23] = 0xBF
-	mem.HighRAM[0x24] = 0x77
-	mem.HighRAM[0x25] = 0xF3
-	mem.HighRAM[0x26] = 0xF1
 	mem.HighRAM[0x40] = 0x91
 	mem.HighRAM[0x41] = 0x85
 	mem.HighRAM[0x42] = 0x00
@@ -87,17 +90,70 @@ func (mem *Memory) Init(gameboy *Gameboy) {
 	mem.HighRAM[0x4B] = 0x00
 	mem.HighRAM[0xFF] = 0x00
 
-	mem.WRAMBank = 1
+	// Set the values which differ between the models
+	model := gameboy.options.model
+	switch model {
+	case ModelSGB, ModelSGB2:
+		// The SGB boot ROM leaves neither of the joypad lines selected
+		mem.HighRAM[0x00] = 0x30
+	case ModelDMG0:
+		// The DMG0 boot ROM finishes partway through VBlank instead of at
+		// the start of the frame
+		mem.gb.ppu = ppuState{Line: 145, Dot: 168}
+		mem.HighRAM[0x41] = 0x81
+		mem.HighRAM[0x44] = 145
+	}
+	if model.IsCGB() {
+		mem.HighRAM[0x02] = 0x7F
+		mem.HighRAM[0x46] = 0x00
+	} else {
+		mem.HighRAM[0x02] = 0x7E
+		mem.HighRAM[0x46] = 0xFF
+	}
+	mem.initSound(model)
+}
+
+// Set the sound registers to the values the boot ROM leaves behind. The sound
+// registers are held by the APU rather than in HighRAM.
+func (mem *Memory) initSound(model Model) {
+	sound := mem.gb.Sound
+	for _, reg := range [][2]byte{{0x26, 0x80}, {0x11, 0x80}, {0x12, 0xF3}, {0x24, 0x77}, {0x25, 0xF3}} {
+		sound.Write(0xFF00+uint16(reg[0]), reg[1])
+	}
+	if model == ModelSGB || model == ModelSGB2 {
+		return
+	}
+
+	// The other boot ROMs finish by playing a chime on channel 1, which has
+	// faded out but is still playing when the game starts. The channel is
+	// triggered at volume 0 and then given the envelope of the chime.
+	sound.Write(0xFF12, 0x08)
+	sound.Write(0xFF13, 0xC1)
+	sound.Write(0xFF14, 0x87)
+	sound.Write(0xFF12, 0xF3)
+}
+
+// Check if an address is mapped to the boot ROM.
+func (mem *Memory) isBootROMAddress(address uint16) bool {
+	return address < 0x100 ||
+		(len(mem.bootROM) == cgbBootROMSize && address >= 0x200 && address < cgbBootROMSize)
 }
 
-// LoadCart load a cart rom into memory.
-func (mem *Memory) LoadCart(loc string) (bool, error) {
-	var err error
-	mem.Cart, err = cart.NewCartFromFile(loc)
-	if err != nil {
-		return false, err
+// Unmap the boot ROM from memory, which happens at the end of the boot
+// sequence. If the CGB boot ROM has selected the DMG compatibility mode then
+// the CGB features are disabled.
+func (mem *Memory) unmapBootROM() {
+	mem.bootROMEnabled = false
+	if mem.gb.dmgCompat {
+		mem.gb.cgbMode = false
+		mem.gb.compatPalettes = true
 	}
-	return mem.Cart.GetMode()&cart.CGB != 0, nil
+}
+
+// LoadCart loads a cart into memory. Returns if the cart supports CGB mode.
+func (mem *Memory) LoadCart(c *cart.Cart) bool {
+	mem.Cart = c
+	return mem.Cart.GetMode()&cart.CGB != 0
 }
 
 // WriteHighRam writes to the range 0xFF00-0xFFFF in the memory address
@@ -108,7 +164,7 @@ func (mem *Memory) WriteHighRam(address uint16, value byte) {
 		// Restricted RAM
 		return
 
-	case address >= 0xFF10 && address <= 0xFF26:
+	case address >= 0xFF10 && address < 0xFF30:
 		mem.gb.Sound.Write(address, value)
 
 	case address >= 0xFF30 && address <= 0xFF3F:
@@ -124,30 +180,30 @@ func (mem *Memory) WriteHighRam(address uint16, value byte) {
 			}
 		}
 
-	case address == DIV:
-		// Trap divider register
-		mem.gb.setClockFreq()
-		mem.gb.CPU.Divider = 0
-		mem.HighRAM[DIV-0xFF00] = 0
-
-	case address == TIMA:
-		mem.HighRAM[TIMA-0xFF00] = value
-
-	case address == TMA:
-		mem.HighRAM[TMA-0xFF00] = value
+	case address >= DIV && address <= TAC:
+		mem.gb.Timer.Write(address, value)
 
-	case address == TAC:
-		// Timer control
-		currentFreq := mem.gb.getClockFreq()
-		mem.HighRAM[TAC-0xFF00] = value | 0xF8
-		newFreq := mem.gb.getClockFreq()
-
-		if currentFreq != newFreq {
-			mem.gb.setClockFreq()
+	case address == LCDC:
+		enabled := mem.gb.isLCDEnabled()
+		mem.HighRAM[0x40] = value
+		if !enabled && mem.gb.isLCDEnabled() {
+			// LY is compared with LYC as soon as the LCD is enabled
+			mem.gb.updateStat()
 		}
 
 	case address == 0xFF41:
-		mem.HighRAM[0x41] = value | 0x80
+		// The mode and coincidence flags are read only
+		mem.HighRAM[0x41] = value&0x78 | mem.HighRAM[0x41]&0x07 | 0x80
+		if mem.gb.isLCDEnabled() {
+			mem.gb.updateStat()
+		}
+
+	case address == 0xFF45:
+		// Changing LYC can trigger the STAT interrupt straight away
+		mem.HighRAM[0x45] = value
+		if mem.gb.isLCDEnabled() {
+			mem.gb.updateStat()
+		}
 
 	case address == 0xFF44:
 		// Trap scanline register
@@ -155,7 +211,21 @@ func (mem *Memory) WriteHighRam(address uint16, value byte) {
 
 	case address == 0xFF46:
 		// DMA transfer
-		mem.doDMATransfer(value)
+		mem.HighRAM[0x46] = value
+		mem.startDMATransfer(value)
+
+	case address == 0xFF4C:
+		// CGB mode select, can only be written by the boot ROM
+		if mem.bootROMEnabled && mem.gb.IsCGB() {
+			mem.gb.dmgCompat = bits.Test(value, 2)
+			mem.HighRAM[0x4C] = value
+		}
+
+	case address == 0xFF50:
+		// Boot ROM unmap
+		if mem.bootROMEnabled && value != 0 {
+			mem.unmapBootROM()
+		}
 
 	case address == 0xFF4D:
 		// CGB speed change
@@ -227,6 +297,9 @@ func (mem *Memory) Write(address uint16, value byte) {
 
 	case address < 0xA000:
 		// VRAM Banking
+		if !mem.vramAccessible() {
+			return
+		}
 		bankOffset := uint16(mem.VRAMBank) * 0x2000
 		mem.VRAM[address-0x8000+bankOffset] = value
 
@@ -243,13 +316,14 @@ func (mem *Memory) Write(address uint16, value byte) {
 		mem.WRAM[(address-0xC000)+(uint16(mem.WRAMBank)*0x1000)] = value
 
 	case address < 0xFE00:
-		// Echo RAM
-		// TODO: re-enable echo RAM?
-		//mem.Data[address] = value
-		//mem.Write(address-0x2000, value)
+		// Echo RAM mirrors the internal RAM
+		mem.Write(address-0x2000, value)
 
 	case address < 0xFEA0:
 		// Object Attribute Memory
+		if !mem.oamAccessible() {
+			return
+		}
 		mem.OAM[address-0xFE00] = value
 
 	case address < 0xFF00:
@@ -267,12 +341,18 @@ func (mem *Memory) Write(address uint16, value byte) {
 func (mem *Memory) Read(address uint16) byte {
 	switch {
 	case address < 0x8000:
-		// Cartridge ROM
+		// Cartridge ROM, or the boot ROM while it is mapped
+		if mem.bootROMEnabled && mem.isBootROMAddress(address) {
+			return mem.bootROM[address]
+		}
 		return mem.Cart.Read(address)
 
 	case address < 0xA000:
 		// VRAM Banking
 		// TODO: check this is correct
+		if !mem.vramAccessible() {
+			return 0xFF
+		}
 		bankOffset := uint16(mem.VRAMBank) * 0x2000
 		return mem.VRAM[address-0x8000+bankOffset]
 
@@ -289,14 +369,14 @@ func (mem *Memory) Read(address uint16) byte {
 		return mem.WRAM[(address-0xC000)+(uint16(mem.WRAMBank)*0x1000)]
 
 	case address < 0xFE00:
-		// Echo RAM
-		// TODO: re-enable echo RAM?
-		//mem.Data[address] = value
-		//mem.Write(address-0x2000, value)
-		return 0xFF
+		// Echo RAM mirrors the internal RAM
+		return mem.Read(address - 0x2000)
 
 	case address < 0xFEA0:
 		// Object Attribute Memory
+		if !mem.oamAccessible() {
+			return 0xFF
+		}
 		return mem.OAM[address-0xFE00]
 
 	case address < 0xFF00:
@@ -308,6 +388,19 @@ func (mem *Memory) Read(address uint16) byte {
 	}
 }
 
+// Check if the CPU can access VRAM. The PPU uses VRAM while it is drawing
+// pixels in mode 3, so the CPU reads 0xFF and its writes are ignored.
+func (mem *Memory) vramAccessible() bool {
+	return mem.gb.options.unrestrictedAccess || mem.gb.lcdMode() != 3
+}
+
+// Check if the CPU can access OAM. The PPU uses OAM while it is scanning for
+// sprites in mode 2 and drawing pixels in mode 3.
+func (mem *Memory) oamAccessible() bool {
+	mode := mem.gb.lcdMode()
+	return mem.gb.options.unrestrictedAccess || (mode != 2 && mode != 3)
+}
+
 // ReadHighRam reads from 0xFF00-0xFFFF in the memory address space. The range
 // includes both HRAM and the hardware registers.
 func (mem *Memory) ReadHighRam(address uint16) byte {
@@ -316,7 +409,7 @@ func (mem *Memory) ReadHighRam(address uint16) byte {
 	case address == 0xFF00:
 		return mem.gb.joypadValue(mem.HighRAM[0x00])
 
-	case address >= 0xFF10 && address <= 0xFF26:
+	case address >= 0xFF10 && address < 0xFF30:
 		return mem.gb.Sound.Read(address)
 
 	case address >= 0xFF30 && address <= 0xFF3F:
@@ -326,37 +419,47 @@ func (mem *Memory) ReadHighRam(address uint16) byte {
 	case address == 0xFF0F:
 		return mem.HighRAM[0x0F] | 0xE0
 
+	case address >= DIV && address <= TAC:
+		return mem.gb.Timer.Read(address)
+
+	case address == 0xFF02:
+		// Serial control, the clock speed bit is only used on the CGB
+		if mem.gb.IsCGB() {
+			return mem.HighRAM[0x02] | 0x7C
+		}
+		return mem.HighRAM[0x02] | 0x7E
+
+	case address == 0xFF03 || (address >= 0xFF08 && address <= 0xFF0E):
+		// Unmapped registers
+		return 0xFF
+
+	case !mem.gb.IsCGB() && address >= 0xFF4C && address < 0xFF80:
+		// CGB registers are not mapped on the DMG
+		return 0xFF
+
 	case address >= 0xFF72 && address <= 0xFF77:
 		//log.Print("read from ", address)
 		return 0
 
 	case address == 0xFF68:
 		// BG palette index
-		if mem.gb.IsCGB() {
-			return mem.gb.BGPalette.readIndex()
-		}
-		return 0
+		return mem.gb.BGPalette.readIndex()
 
 	case address == 0xFF69:
 		// BG Palette data
-		if mem.gb.IsCGB() {
-			return mem.gb.BGPalette.read()
-		}
-		return 0
+		return mem.gb.BGPalette.read()
 
 	case address == 0xFF6A:
 		// Sprite palette index
-		if mem.gb.IsCGB() {
-			return mem.gb.SpritePalette.readIndex()
-		}
-		return 0
+		return mem.gb.SpritePalette.readIndex()
 
 	case address == 0xFF6B:
 		// Sprite Palette data
-		if mem.gb.IsCGB() {
-			return mem.gb.SpritePalette.read()
-		}
-		return 0
+		return mem.gb.SpritePalette.read()
+
+	case address == 0xFF50:
+		// Boot ROM unmap register is write only
+		return 0xFF
 
 	case address == 0xFF4D:
 		// Speed switch data
@@ -373,48 +476,112 @@ func (mem *Memory) ReadHighRam(address uint16) byte {
 	}
 }
 
-// Perform a DMA transfer.
-func (mem *Memory) doDMATransfer(value byte) {
-	// TODO: This may need to be done instead of CPU ticks
-	address := uint16(value) << 8 // (data * 100)
+// Request an OAM DMA transfer from a source address. The transfer starts after
+// a delay of one M-cycle, and if a transfer is already running then it carries
+// on until the new transfer starts.
+func (mem *Memory) startDMATransfer(value byte) {
+	mem.dmaStartSource = uint16(value) << 8
+	mem.dmaStarting = 2
+}
+
+// Run the OAM DMA for a single M-cycle. Each M-cycle one byte is copied from
+// the source to OAM, so the transfer takes 160 M-cycles.
+func (mem *Memory) tickDMA() {
+	if mem.dmaActive {
+		mem.dmaValue = mem.readDMASource(mem.dmaSource + mem.dmaIndex)
+		mem.OAM[mem.dmaIndex] = mem.dmaValue
+		mem.dmaIndex++
+		if mem.dmaIndex == 0xA0 {
+			mem.dmaActive = false
+		}
+	}
+	if mem.dmaStarting > 0 {
+		mem.dmaStarting--
+		if mem.dmaStarting == 0 {
+			mem.dmaActive = true
+			mem.dmaSource = mem.dmaStartSource
+			mem.dmaIndex = 0
+		}
+	}
+}
 
-	var i uint16
-	for i = 0; i < 0xA0; i++ {
-		// TODO: Check this doesn't prevent
-		mem.Write(0xFE00+i, mem.Read(address+i))
+// Read a byte for the OAM DMA. Sources from 0xE000 upwards read from WRAM,
+// including the range above the echo RAM.
+func (mem *Memory) readDMASource(address uint16) byte {
+	if address >= 0xE000 {
+		address -= 0x2000
 	}
+	return mem.Read(address)
+}
+
+// Check if a CPU access conflicts with a running OAM DMA transfer. The DMA
+// uses OAM and the bus it is reading from, which is either the VRAM bus or the
+// external bus for the cartridge and WRAM, so only the high RAM and registers
+// and the other bus are free. Conflicting reads get the byte which the DMA is
+// transferring, or 0xFF for OAM.
+func (mem *Memory) dmaConflict(address uint16) (byte, bool) {
+	if !mem.dmaActive || address >= 0xFF00 {
+		return 0, false
+	}
+	if address >= 0xFE00 {
+		return 0xFF, true
+	}
+	if isVRAMAddress(address) != isVRAMAddress(mem.dmaSource) {
+		return 0, false
+	}
+	return mem.dmaValue, true
+}
+
+// Check if an address is on the VRAM bus.
+func isVRAMAddress(address uint16) bool {
+	return address >= 0x8000 && address < 0xA000
 }
 
 // Start a CGB DMA transfer.
 func (mem *Memory) doNewDMATransfer(value byte) {
 	if mem.hdmaActive && bits.Val(value, 7) == 0 {
-		// Abort a HDMA transfer
+		// Abort a HDMA transfer, the remaining length can still be read
 		mem.hdmaActive = false
-		mem.HighRAM[0x55] |= 0x80 // Set bit 7
+		mem.HighRAM[0x55] = mem.hdmaLength | 0x80
 		return
 	}
 
-	length := ((uint16(value) & 0x7F) + 1) * 0x10
-
 	// The 7th bit is DMA mode
 	if value>>7 == 0 {
 		// Mode 0, general purpose DMA
-		mem.performNewDMATransfer(length)
+		blocks := int(value&0x7F) + 1
+		mem.performNewDMATransfer(uint16(blocks) * 0x10)
+		mem.hdmaStall += blocks * mem.hdmaBlockCycles()
 		mem.HighRAM[0x55] = 0xFF
 	} else {
 		// Mode 1, H-Blank DMA
-		mem.hdmaLength = byte(value)
+		mem.hdmaLength = value & 0x7F
 		mem.hdmaActive = true
+		mem.HighRAM[0x55] = mem.hdmaLength
+		if mem.gb.lcdMode() == 0 {
+			// A block is copied straight away if the PPU is already in
+			// HBlank or the LCD is off
+			mem.doHDMATransfer()
+		}
 	}
 }
 
-// Perform a HDMA transfer during a HBlank period.
+// Get the number of M-cycles it takes to copy a block of 16 bytes with the
+// GDMA or HDMA. The copy takes the same time in both speed modes, so it takes
+// twice as many M-cycles in double speed mode.
+func (mem *Memory) hdmaBlockCycles() int {
+	return 8 * mem.gb.getSpeed()
+}
+
+// Perform a HDMA transfer during a HBlank period. Blocks are not copied while
+// the CPU is halted.
 func (mem *Memory) doHDMATransfer() {
-	if !mem.hdmaActive {
+	if !mem.hdmaActive || mem.gb.halted {
 		return
 	}
 
 	mem.performNewDMATransfer(0x10)
+	mem.hdmaStall += mem.hdmaBlockCycles()
 	if mem.hdmaLength > 0 {
 		mem.hdmaLength--
 		mem.HighRAM[0x55] = mem.hdmaLength
@@ -432,9 +599,11 @@ func (mem *Memory) performNewDMATransfer(length uint16) {
 	destination := (uint16(mem.HighRAM[0x53])<<8 | uint16(mem.HighRAM[0x54])) & 0x1FF0
 	destination += 0x8000
 
-	// Transfer the data from the source to the destination
+	// Transfer the data from the source to the destination. The transfer
+	// writes to VRAM directly so it is not blocked by the PPU mode.
+	bankOffset := uint16(mem.VRAMBank) * 0x2000
 	for i := uint16(0); i < length; i++ {
-		mem.Write(destination, mem.Read(source))
+		mem.VRAM[(destination&0x1FFF)+bankOffset] = mem.Read(source)
 		destination++
 		source++
 	}
@@ -0,0 +1,103 @@
+package gb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model is a revision of the Gameboy hardware. The model determines the state
+// the boot ROM leaves the registers in, and whether CGB features are available.
+type Model int
+
+const (
+	// ModelDefault is the zero value of the model, which selects the default
+	// model of ModelDMG.
+	ModelDefault Model = iota
+	// ModelDMG0 is the early revision of the original Gameboy.
+	ModelDMG0
+	// ModelDMG is the original Gameboy.
+	ModelDMG
+	// ModelMGB is the Gameboy Pocket.
+	ModelMGB
+	// ModelSGB is the Super Gameboy.
+	ModelSGB
+	// ModelSGB2 is the Super Gameboy 2.
+	ModelSGB2
+	// ModelCGB is the Gameboy Color.
+	ModelCGB
+	// ModelAGB is the Gameboy Advance running a Gameboy Color game.
+	ModelAGB
+)
+
+var modelNames = map[Model]string{
+	ModelDMG0: "dmg0",
+	ModelDMG:  "dmg",
+	ModelMGB:  "mgb",
+	ModelSGB:  "sgb",
+	ModelSGB2: "sgb2",
+	ModelCGB:  "cgb",
+	ModelAGB:  "agb",
+}
+
+// String returns the short name of the model.
+func (m Model) String() string {
+	if name, ok := modelNames[m]; ok {
+		return name
+	}
+	if m == ModelDefault {
+		return "default"
+	}
+	return fmt.Sprintf("Model(%d)", int(m))
+}
+
+// IsCGB returns if the model supports the CGB features.
+func (m Model) IsCGB() bool {
+	return m == ModelCGB || m == ModelAGB
+}
+
+// ParseModel returns the model with a short name, e.g. "dmg" or "cgb". The
+// ModelDefault is returned with the error if the name is not a model.
+func ParseModel(name string) (Model, error) {
+	name = strings.ToLower(name)
+	for model, modelName := range modelNames {
+		if modelName == name {
+			return model, nil
+		}
+	}
+	return ModelDefault, fmt.Errorf("unknown model %q", name)
+}
+
+// Values of the CPU registers after the boot ROM has finished.
+type bootRegisters struct {
+	AF, BC, DE, HL uint16
+}
+
+// Get the values of the CPU registers the boot ROM of the model leaves behind.
+// The CGB boot ROM leaves different values when running a game in the DMG
+// compatibility mode.
+func (m Model) bootRegisters(cgbGame bool) bootRegisters {
+	switch m {
+	case ModelDMG0:
+		return bootRegisters{AF: 0x0100, BC: 0xFF13, DE: 0x00C1, HL: 0x8403}
+	case ModelMGB:
+		return bootRegisters{AF: 0xFFB0, BC: 0x0013, DE: 0x00D8, HL: 0x014D}
+	case ModelSGB:
+		return bootRegisters{AF: 0x0100, BC: 0x0014, DE: 0x0000, HL: 0xC060}
+	case ModelSGB2:
+		return bootRegisters{AF: 0xFF00, BC: 0x0014, DE: 0x0000, HL: 0xC060}
+	case ModelCGB:
+		if !cgbGame {
+			return bootRegisters{AF: 0x1180, BC: 0x0000, DE: 0x0008, HL: 0x007C}
+		}
+		return bootRegisters{AF: 0x1180, BC: 0x0000, DE: 0xFF56, HL: 0x000D}
+	case ModelAGB:
+		// The AGB boot ROM increments B before finishing, which also
+		// changes the flags
+		if !cgbGame {
+			return bootRegisters{AF: 0x1100, BC: 0x0100, DE: 0x0008, HL: 0x007C}
+		}
+		return bootRegisters{AF: 0x1100, BC: 0x0100, DE: 0xFF56, HL: 0x000D}
+	default:
+		return bootRegisters{AF: 0x01B0, BC: 0x0013, DE: 0x00D8, HL: 0x014D}
+	}
+}
@@ -0,0 +1,93 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestModel_BootRegisters runs the mooneye boot register test roms on the
+// models they are written for.
+func TestModel_BootRegisters(t *testing.T) {
+	tests := map[string]Model{
+		"boot_regs-dmg0":   ModelDMG0,
+		"boot_regs-dmgABC": ModelDMG,
+		"boot_regs-mgb":    ModelMGB,
+		"boot_regs-sgb":    ModelSGB,
+		"boot_regs-sgb2":   ModelSGB2,
+	}
+	for name, model := range tests {
+		t.Run(name, func(t *testing.T) {
+			gb, err := NewGameboy(romPath+"/"+name+".gb", WithModel(model))
+			require.NoError(t, err, "error in init gb %v", err)
+			for i := 0; i < 100 && !inFinishLoop(gb); i++ {
+				gb.Update()
+			}
+			assert.True(t, passedTest(gb), "registers do not match expected")
+		})
+	}
+}
+
+// TestModel_BootHWIO runs the mooneye boot I/O register test roms on each of
+// the models they are written for.
+func TestModel_BootHWIO(t *testing.T) {
+	tests := map[string][]Model{
+		"boot_hwio-dmg0":      {ModelDMG0},
+		"boot_hwio-dmgABCmgb": {ModelDMG, ModelMGB},
+		"boot_hwio-S":         {ModelSGB, ModelSGB2},
+	}
+	for name, models := range tests {
+		for _, model := range models {
+			t.Run(name+"/"+model.String(), func(t *testing.T) {
+				gb, err := NewGameboy(romPath+"/"+name+".gb", WithModel(model))
+				require.NoError(t, err, "error in init gb %v", err)
+				for i := 0; i < 100 && !inFinishLoop(gb); i++ {
+					gb.Update()
+				}
+				assert.True(t, passedTest(gb), "registers do not match expected")
+			})
+		}
+	}
+}
+
+// TestModel_CGB asserts that CGB mode is only used when both the model and
+// the game support it.
+func TestModel_CGB(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	rom[0x143] = 0x80
+
+	for _, model := range []Model{ModelDMG, ModelSGB, ModelCGB, ModelAGB} {
+		gb, err := NewGameboyFromROM(rom, WithModel(model))
+		require.NoError(t, err, "error in init gb %v", err)
+		assert.Equal(t, model.IsCGB(), gb.IsCGB(), "unexpected cgb mode for %v", model)
+	}
+
+	gb, err := NewGameboyFromROM(make([]byte, 0x8000), WithModel(ModelCGB))
+	require.NoError(t, err, "error in init gb %v", err)
+	assert.False(t, gb.IsCGB(), "dmg game should not run in cgb mode")
+	assert.Equal(t, byte(0xFF), gb.Memory.Read(0xFF4F), "cgb registers should not be mapped")
+}
+
+// TestParseModel asserts that models can be parsed from their names.
+func TestParseModel(t *testing.T) {
+	for model, name := range modelNames {
+		parsed, err := ParseModel(name)
+		require.NoError(t, err)
+		assert.Equal(t, model, parsed)
+		assert.Equal(t, name, model.String())
+	}
+	parsed, err := ParseModel("gba")
+	assert.Error(t, err)
+	assert.Equal(t, ModelDefault, parsed)
+}
+
+// TestModel_Default asserts that the zero value of the model selects the DMG.
+func TestModel_Default(t *testing.T) {
+	for _, opts := range [][]GameboyOption{nil, {WithModel(ModelDefault)}} {
+		gb, err := NewGameboyFromROM(make([]byte, 0x8000), opts...)
+		require.NoError(t, err, "error in init gb %v", err)
+		assert.Equal(t, ModelDMG, gb.Model())
+	}
+	assert.Equal(t, "default", ModelDefault.String())
+}
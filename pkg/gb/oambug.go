@@ -0,0 +1,96 @@
+package gb
+
+// Number of rows of 8 bytes in OAM. The PPU reads a row each M-cycle of the
+// OAM scan.
+const oamRows = 20
+
+// Type of CPU access which can trigger the OAM corruption bug.
+type oamBugAccess int
+
+const (
+	// A write, or an increment or decrement of a 16-bit register.
+	oamBugWrite oamBugAccess = iota
+	// A read.
+	oamBugRead
+	// A read at the same time as the address is incremented or decremented,
+	// as done by LD A,(HL+), LD A,(HL-) and POP.
+	oamBugReadIncrement
+)
+
+// Corrupt OAM if the CPU puts an address in 0xFE00-0xFEFF on the bus while the
+// PPU is scanning OAM. This is a bug in the DMG which is only emulated if it
+// has been enabled with WithOAMBug. The row of OAM which the PPU is reading is
+// corrupted with values from the rows before it.
+func (gb *Gameboy) triggerOAMBug(address uint16, access oamBugAccess) {
+	if !gb.options.oamBug || gb.options.model.IsCGB() {
+		return
+	}
+	if address < 0xFE00 || address > 0xFEFF || !gb.isLCDEnabled() || gb.lcdMode() != 2 {
+		return
+	}
+	// The first row is never corrupted
+	row := gb.ppu.Dot / 4
+	if row < 1 || row >= oamRows {
+		return
+	}
+
+	switch access {
+	case oamBugWrite:
+		gb.corruptOAMWrite(row)
+	case oamBugRead:
+		gb.corruptOAMRead(row)
+	case oamBugReadIncrement:
+		gb.corruptOAMReadIncrement(row)
+	}
+}
+
+// Corrupt a row of OAM for a write.
+func (gb *Gameboy) corruptOAMWrite(row int) {
+	a := gb.oamWord(row, 0)
+	b := gb.oamWord(row-1, 0)
+	c := gb.oamWord(row-1, 2)
+	gb.setOAMWord(row, ((a^c)&(b^c))^c)
+	gb.copyOAMRow(row, row-1, 2)
+}
+
+// Corrupt a row of OAM for a read.
+func (gb *Gameboy) corruptOAMRead(row int) {
+	a := gb.oamWord(row, 0)
+	b := gb.oamWord(row-1, 0)
+	c := gb.oamWord(row-1, 2)
+	gb.setOAMWord(row, b|(a&c))
+	gb.copyOAMRow(row, row-1, 2)
+}
+
+// Corrupt a row of OAM for a read while the address is being incremented. The
+// row before is corrupted and copied over two rows, unless the row is one of
+// the first four or the last, and then the read corruption happens as well.
+func (gb *Gameboy) corruptOAMReadIncrement(row int) {
+	if row >= 4 && row < oamRows-1 {
+		a := gb.oamWord(row-2, 0)
+		b := gb.oamWord(row-1, 0)
+		c := gb.oamWord(row, 0)
+		d := gb.oamWord(row-1, 2)
+		gb.setOAMWord(row-1, (b&(a|c|d))|(a&c&d))
+		gb.copyOAMRow(row, row-1, 0)
+		gb.copyOAMRow(row-2, row-1, 0)
+	}
+	gb.corruptOAMRead(row)
+}
+
+// Get one of the four 16-bit words in a row of OAM.
+func (gb *Gameboy) oamWord(row int, word int) uint16 {
+	i := row*8 + word*2
+	return uint16(gb.Memory.OAM[i]) | uint16(gb.Memory.OAM[i+1])<<8
+}
+
+// Set the first 16-bit word in a row of OAM.
+func (gb *Gameboy) setOAMWord(row int, value uint16) {
+	gb.Memory.OAM[row*8] = byte(value)
+	gb.Memory.OAM[row*8+1] = byte(value >> 8)
+}
+
+// Copy the bytes of a row of OAM from another row, starting at a byte offset.
+func (gb *Gameboy) copyOAMRow(dst, src int, from int) {
+	copy(gb.Memory.OAM[dst*8+from:dst*8+8], gb.Memory.OAM[src*8+from:src*8+8])
+}
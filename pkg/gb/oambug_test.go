@@ -0,0 +1,88 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Create an idle Gameboy with OAM filled with a pattern, and run the PPU to the
+// OAM scan of a row on line 1.
+func oamBugGameboy(t *testing.T, row int, options ...GameboyOption) *Gameboy {
+	gb, err := NewGameboyFromROM(programROM(0x18, 0xFE), options...)
+	require.NoError(t, err, "error in init gb %v", err)
+	for i := range gb.Memory.OAM[:oamRows*8] {
+		gb.Memory.OAM[i] = byte(i)
+	}
+	for gb.ppu.Line != 1 || gb.ppu.Dot != row*4 {
+		gb.updateDot()
+	}
+	require.Equal(t, byte(2), gb.lcdMode())
+	return gb
+}
+
+// TestOAMBug_Write asserts that a write corrupts the row being scanned.
+func TestOAMBug_Write(t *testing.T) {
+	gb := oamBugGameboy(t, 2, WithOAMBug())
+	gb.setOAMWord(2, 0xF0F0)
+	gb.setOAMWord(1, 0x0FF0)
+	gb.Memory.OAM[12], gb.Memory.OAM[13] = 0xFF, 0x00
+
+	gb.triggerOAMBug(0xFE00, oamBugWrite)
+	assert.Equal(t, uint16(0x00F0), gb.oamWord(2, 0))
+	assert.Equal(t, gb.Memory.OAM[10:16], gb.Memory.OAM[18:24])
+}
+
+// TestOAMBug_Read asserts that a read corrupts the row being scanned.
+func TestOAMBug_Read(t *testing.T) {
+	gb := oamBugGameboy(t, 2, WithOAMBug())
+	gb.setOAMWord(2, 0xF0F0)
+	gb.setOAMWord(1, 0x0F00)
+	gb.Memory.OAM[12], gb.Memory.OAM[13] = 0xFF, 0x00
+
+	gb.triggerOAMBug(0xFE00, oamBugRead)
+	assert.Equal(t, uint16(0x0FF0), gb.oamWord(2, 0))
+	assert.Equal(t, gb.Memory.OAM[10:16], gb.Memory.OAM[18:24])
+}
+
+// TestOAMBug_ReadIncrement asserts that a read while incrementing corrupts the
+// row before the row being scanned and copies it over two rows.
+func TestOAMBug_ReadIncrement(t *testing.T) {
+	gb := oamBugGameboy(t, 5, WithOAMBug())
+	gb.triggerOAMBug(0xFE00, oamBugReadIncrement)
+	assert.Equal(t, gb.Memory.OAM[32:40], gb.Memory.OAM[24:32], "row should be copied to the row before")
+	assert.Equal(t, gb.Memory.OAM[34:40], gb.Memory.OAM[42:48])
+}
+
+// TestOAMBug_Disabled asserts that OAM is not corrupted unless the bug is
+// enabled, or on the CGB, or outside of the OAM scan.
+func TestOAMBug_Disabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		address uint16
+		options []GameboyOption
+	}{
+		{"not enabled", 0xFE00, nil},
+		{"cgb", 0xFE00, []GameboyOption{WithOAMBug(), WithModel(ModelCGB)}},
+		{"outside oam", 0xC000, []GameboyOption{WithOAMBug()}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gb := oamBugGameboy(t, 2, test.options...)
+			oam := gb.Memory.OAM
+			gb.triggerOAMBug(test.address, oamBugWrite)
+			assert.Equal(t, oam, gb.Memory.OAM)
+		})
+	}
+}
+
+// TestOAMBug_IncrementRegister asserts that incrementing a register which
+// points to OAM during the OAM scan corrupts OAM.
+func TestOAMBug_IncrementRegister(t *testing.T) {
+	gb := oamBugGameboy(t, 2, WithOAMBug())
+	oam := gb.Memory.OAM
+	gb.CPU.HL.Set(0xFE10)
+	gb.instInc16(gb.CPU.HL.Set, gb.CPU.HL.HiLo())
+	assert.NotEqual(t, oam, gb.Memory.OAM)
+}
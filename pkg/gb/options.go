@@ -1,14 +1,45 @@
 package gb
 
+import (
+	"github.com/Humpheh/goboy/pkg/apu"
+	"github.com/Humpheh/goboy/pkg/apu/otosink"
+	"github.com/Humpheh/goboy/pkg/cart"
+)
+
 // GameboyOption is an option for the Gameboy execution.
 type GameboyOption func(o *gameboyOptions)
 
 type gameboyOptions struct {
-	sound   bool
-	cgbMode bool
+	model Model
+
+	// Sink the audio is output to, nil if there is no audio output
+	audioSink apu.AudioSink
+	// Play the audio through the sound card if there is no other sink
+	sound bool
+
+	// WAV file to record the audio to from the start, and whether each of the
+	// channels is recorded to a separate stem
+	recordPath  string
+	recordStems bool
 
 	// Callback when the serial port is written to
 	transferFunction func(byte)
+
+	// Storage for the battery backed cartridge RAM
+	saveStore cart.SaveStore
+
+	// Allow the CPU to access VRAM and OAM while the PPU is using them
+	unrestrictedAccess bool
+
+	// Emulate the corruption of OAM by the DMG during the OAM scan
+	oamBug bool
+
+	// Boot ROM to run before the game, nil to skip the boot sequence
+	bootROM []byte
+
+	// Rewind buffer settings, rewind is disabled if rewindBytes is 0
+	rewindInterval int
+	rewindBytes    int
 }
 
 // DebugFlags are flags which can be set to alter the execution of the Gameboy.
@@ -37,20 +68,69 @@ func (flags *DebugFlags) toggleOutputOpCode() {
 	flags.OutputOpcodes = !flags.OutputOpcodes
 }
 
-// WithCGBEnabled runs the Gameboy with cgb mode enabled.
+// WithCGBEnabled runs the Gameboy with cgb mode enabled. This is the same as
+// running with the CGB model.
 func WithCGBEnabled() GameboyOption {
+	return WithModel(ModelCGB)
+}
+
+// WithModel sets the hardware model to emulate. Games which support CGB
+// features will only run in CGB mode on the CGB and AGB models. Defaults to
+// the DMG model, which is also used for ModelDefault.
+func WithModel(model Model) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.model = model
+	}
+}
+
+// WithAudioSink outputs the audio of the Gameboy to a sink. The frames are
+// pushed to the sink as they are generated, and any remaining frames at the
+// end of each call to Update.
+func WithAudioSink(sink apu.AudioSink) GameboyOption {
 	return func(o *gameboyOptions) {
-		o.cgbMode = true
+		o.audioSink = sink
 	}
 }
 
-// WithSound runs the Gameboy with sound output.
+// WithSound runs the Gameboy with sound output through the sound card.
+//
+// Deprecated: use WithAudioSink with a sink from the otosink package, which
+// can be closed when the Gameboy is finished with.
 func WithSound() GameboyOption {
 	return func(o *gameboyOptions) {
 		o.sound = true
 	}
 }
 
+// Open the sound card sink for the deprecated WithSound option.
+func (o *gameboyOptions) openSoundSink() error {
+	if !o.sound || o.audioSink != nil {
+		return nil
+	}
+	sink, err := otosink.New()
+	if err != nil {
+		return err
+	}
+	o.audioSink = sink
+	return nil
+}
+
+// WithRecording records the mixed audio output to a WAV file from when the
+// Gameboy starts. The recording is finished by StopRecording.
+func WithRecording(path string) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.recordPath = path
+	}
+}
+
+// WithRecordingStems records each of the sound channels to a separate WAV file
+// alongside the mixed audio when recording, named by apu.StemPath.
+func WithRecordingStems() GameboyOption {
+	return func(o *gameboyOptions) {
+		o.recordStems = true
+	}
+}
+
 // WithTransferFunction provides a function to callback on when the serial transfer
 // address is written to.
 func WithTransferFunction(transfer func(byte)) GameboyOption {
@@ -58,3 +138,56 @@ func WithTransferFunction(transfer func(byte)) GameboyOption {
 		o.transferFunction = transfer
 	}
 }
+
+// WithUnrestrictedAccess allows the CPU to read and write VRAM and OAM in any
+// PPU mode. On hardware the CPU reads 0xFF and its writes are ignored while the
+// PPU is using them, so this is only useful for debugging.
+func WithUnrestrictedAccess() GameboyOption {
+	return func(o *gameboyOptions) {
+		o.unrestrictedAccess = true
+	}
+}
+
+// WithOAMBug emulates the bug in the DMG where OAM is corrupted if the CPU
+// accesses it, or increments or decrements a 16-bit register pointing to it,
+// while the PPU is scanning OAM. The bug does not happen on the CGB models.
+func WithOAMBug() GameboyOption {
+	return func(o *gameboyOptions) {
+		o.oamBug = true
+	}
+}
+
+// WithRewind enables rewinding of the Gameboy. A snapshot is taken every
+// interval frames, and the snapshots will use at most maxBytes of memory,
+// after which the oldest snapshots are discarded.
+func WithRewind(interval int, maxBytes int) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.rewindInterval = interval
+		o.rewindBytes = maxBytes
+	}
+}
+
+// WithSaveStore sets the storage used for saving the battery backed RAM of the
+// cartridge.
+func WithSaveStore(store cart.SaveStore) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.saveStore = store
+	}
+}
+
+// WithSaveDirectory stores the battery backed RAM of the cartridge in a directory
+// instead of next to the rom file.
+func WithSaveDirectory(dir string) GameboyOption {
+	return WithSaveStore(cart.DirectorySaveStore{Dir: dir})
+}
+
+// WithBootROM runs a DMG or CGB boot ROM before starting the game, instead of
+// starting the game with the registers set to their post-boot values. Using the
+// CGB boot ROM will run the Gameboy in CGB mode, with DMG games running in the
+// compatibility mode selected by the boot ROM. If the boot ROM does not match
+// the model then the DMG or CGB model is used instead.
+func WithBootROM(rom []byte) GameboyOption {
+	return func(o *gameboyOptions) {
+		o.bootROM = rom
+	}
+}
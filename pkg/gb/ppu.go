@@ -1,6 +1,8 @@
 package gb
 
 import (
+	"sort"
+
 	"github.com/Humpheh/goboy/pkg/bits"
 )
 
@@ -13,113 +15,227 @@ const (
 
 	// LCDC is the main LCD Control register.
 	LCDC = 0xFF40
+
+	// Number of dots in each scanline, including HBlank.
+	dotsScanline = 456
+	// Number of dots from the start of each visible scanline until the pixel
+	// transfer (mode 3) starts. The OAM scan (mode 2) takes 80 of these dots,
+	// but the start of mode 3 is delayed by a further machine cycle.
+	dotsOAMScan = 84
+	// Number of scanlines in each frame, including VBlank.
+	scanlinesFrame = 154
+	// Maximum number of sprites which can be drawn on a scanline.
+	maxLineSprites = 10
 )
 
-// Update the state of the graphics.
-func (gb *Gameboy) updateGraphics(cycles int) {
-	gb.setLCDStatus()
+// State of the PPU while drawing the current scanline. The fields are exported
+// so that the state can be stored in a save state.
+type ppuState struct {
+	// Scanline and dot within the scanline which the PPU is on. The scanline
+	// is not always the same as LY, which is reset early on the last scanline.
+	Line byte
+	Dot  int
+	// Number of pixels which have been pushed to the LCD on the scanline. This
+	// starts at -8 for the pixels of the discarded first tile, which are not
+	// drawn but can still be overlapped by sprites.
+	X int
+	// Number of pixels still to be discarded from the start of the scanline
+	// to scroll by the lower 3 bits of SCX.
+	Discard int
+
+	BGFIFO     pixelFIFO
+	SpriteFIFO pixelFIFO
+	Fetcher    pixelFetcher
+
+	// Sprites found during the OAM scan ordered by their X position, and the
+	// index of the next sprite to be fetched.
+	Sprites    []lineSprite
+	NextSprite int
+	// Number of dots which have been spent fetching the current sprite.
+	SpriteDots int
+
+	// Set once LY has been equal to WY at the start of a scanline in the
+	// current frame. The window can only be drawn once this has been set.
+	WindowY bool
+	// Internal line counter of the window. This is only incremented on the
+	// scanlines the window is drawn on, so hiding the window part way through
+	// a frame does not skip any of its rows.
+	WindowLine byte
+	// Set when the window was started with WX at 166, which causes the window
+	// to start from the left of the screen on the next scanline.
+	WindowWrap bool
+
+	// Value compared with LYC to set the coincidence flag. This is -1 for a
+	// short time at the start of a scanline while LY is changing, during which
+	// LY never matches LYC.
+	LYCompare int
+	// State of the STAT interrupt line, which is the OR of all of the enabled
+	// STAT interrupt sources. The interrupt is only requested when the line
+	// rises, so a source does not request it while another source is active.
+	StatLine bool
+}
 
+// Update the state of the graphics by a number of cycles. The PPU is advanced
+// one dot at a time, and is not affected by the CGB double speed mode.
+func (gb *Gameboy) updateGraphics(cycles int) {
 	if !gb.isLCDEnabled() {
+		gb.disableLCD()
 		return
 	}
-	gb.scanlineCounter -= cycles
+	if gb.screenCleared {
+		// The LCD has just been enabled part way through the first scanline,
+		// so LY is compared with WY here instead of at the start of it
+		gb.checkWindowY(0)
+	}
+	gb.screenCleared = false
 
-	if gb.scanlineCounter <= 0 {
-		gb.Memory.HighRAM[0x44]++
-		if gb.Memory.HighRAM[0x44] > 153 {
-			gb.PreparedData = gb.screenData
-			gb.screenData = [ScreenWidth][ScreenHeight][3]uint8{}
-			gb.bgPriority = [ScreenWidth][ScreenHeight]bool{}
-			gb.Memory.HighRAM[0x44] = 0
-		}
+	for dots := cycles / gb.getSpeed(); dots > 0; dots-- {
+		gb.updateDot()
+	}
+}
 
-		currentLine := gb.Memory.ReadHighRam(0xFF44)
-		gb.scanlineCounter += 456 * gb.getSpeed()
+// Advance the PPU by a single dot.
+func (gb *Gameboy) updateDot() {
+	ppu := &gb.ppu
+	line := ppu.Line
+	gb.updateLY()
+	if line == ScreenHeight && ppu.Dot == 0 {
+		gb.setLCDMode(1)
+	}
+	if line < ScreenHeight {
+		switch {
+		case ppu.Dot == 0:
+			gb.setLCDMode(2)
+			gb.checkWindowY(line)
+		case ppu.Dot == dotsOAMScan:
+			gb.startPixelTransfer(line)
+		}
 
-		if currentLine == ScreenHeight {
-			gb.requestInterrupt(0)
+		if gb.lcdMode() == 3 {
+			if ppu.X == ScreenWidth {
+				// The full scanline has been drawn so enter HBlank
+				gb.setLCDMode(0)
+				if ppu.Fetcher.Window {
+					ppu.WindowLine++
+				}
+				gb.Memory.doHDMATransfer()
+			} else {
+				gb.drawDot(line)
+			}
 		}
 	}
-}
 
-const (
-	lcdMode2Bounds = 456 - 80
-	lcdMode3Bounds = lcdMode2Bounds - 172
-)
+	gb.updateStat()
 
-// Set the status of the LCD based on the current state of memory.
-func (gb *Gameboy) setLCDStatus() {
-	status := gb.Memory.ReadHighRam(0xFF41)
-
-	if !gb.isLCDEnabled() {
-		// set the screen to white
-		gb.clearScreen()
-
-		gb.scanlineCounter = 456
-		gb.Memory.HighRAM[0x44] = 0
-		status &= 252
-		// TODO: Check this is correct
-		// We aren't in a mode so reset the values
-		status = bits.Reset(status, 0)
-		status = bits.Reset(status, 1)
-		gb.Memory.Write(0xFF41, status)
+	ppu.Dot++
+	if ppu.Dot < dotsScanline {
 		return
 	}
-	gb.screenCleared = false
+	ppu.Dot = 0
+	ppu.Line++
+	if ppu.Line == scanlinesFrame {
+		ppu.Line = 0
+	}
 
-	currentLine := gb.Memory.ReadHighRam(0xFF44)
-	currentMode := status & 0x3
+	if ppu.Line == ScreenHeight {
+		// The frame has been drawn so present it at the start of VBlank
+		gb.PreparedData = gb.screenData
+		gb.frameComplete = true
+		gb.requestInterrupt(0)
+		// The mode 2 STAT interrupt of the first VBlank scanline is requested
+		// at the same time as the VBlank interrupt, before the mode changes
+		gb.updateStat()
+
+		ppu.WindowY = false
+		ppu.WindowLine = 0
+		ppu.WindowWrap = false
+	}
+}
 
-	var mode byte
-	requestInterrupt := false
+// Allow the window to be drawn for the rest of the frame if the scanline which
+// is starting matches WY.
+func (gb *Gameboy) checkWindowY(line byte) {
+	if line == gb.Memory.ReadHighRam(0xFF4A) {
+		gb.ppu.WindowY = true
+	}
+}
+
+// Get the current mode of the LCD from the STAT register.
+func (gb *Gameboy) lcdMode() byte {
+	return gb.Memory.HighRAM[0x41] & 0x3
+}
 
+// Set the mode of the LCD in the STAT register.
+func (gb *Gameboy) setLCDMode(mode byte) {
+	gb.Memory.HighRAM[0x41] = gb.Memory.HighRAM[0x41]&^0x3 | mode
+}
+
+// Update LY and the value of LY which is compared with LYC at the start of a
+// scanline. LY changes on the first dot of the scanline, but the comparison is
+// not made for the first 4 dots while it is changing. On the last scanline LY
+// is reset to 0 after 4 dots, so LYC matches 153 and then 0 during the
+// scanline.
+func (gb *Gameboy) updateLY() {
+	ppu := &gb.ppu
+	lastLine := ppu.Line == scanlinesFrame-1
 	switch {
-	case currentLine >= 144:
-		mode = 1
-		status = bits.Set(status, 0)
-		status = bits.Reset(status, 1)
-		requestInterrupt = bits.Test(status, 4)
-	case gb.scanlineCounter >= lcdMode2Bounds:
-		mode = 2
-		status = bits.Reset(status, 0)
-		status = bits.Set(status, 1)
-		requestInterrupt = bits.Test(status, 5)
-	case gb.scanlineCounter >= lcdMode3Bounds:
-		mode = 3
-		status = bits.Set(status, 0)
-		status = bits.Set(status, 1)
-		if mode != currentMode {
-			// Draw the scanline when we start mode 3. In the real GameBoy
-			// this would be done throughout mode 3 by reading OAM and VRAM
-			// to generate the picture.
-			gb.drawScanline(currentLine)
-		}
-	default:
-		mode = 0
-		status = bits.Reset(status, 0)
-		status = bits.Reset(status, 1)
-		requestInterrupt = bits.Test(status, 3)
-		if mode != currentMode {
-			gb.Memory.doHDMATransfer()
+	case ppu.Dot == 0 && ppu.Line != 0:
+		ppu.LYCompare = -1
+		gb.Memory.HighRAM[0x44] = ppu.Line
+	case ppu.Dot == 4:
+		ppu.LYCompare = int(ppu.Line)
+		if lastLine {
+			gb.Memory.HighRAM[0x44] = 0
 		}
+	case ppu.Dot == 8 && lastLine:
+		ppu.LYCompare = -1
+	case ppu.Dot == 12 && lastLine:
+		ppu.LYCompare = 0
 	}
+}
 
-	if requestInterrupt && mode != currentMode {
-		gb.requestInterrupt(1)
-	}
-
-	// Check if LYC == LY (coincidence flag)
-	if currentLine == gb.Memory.ReadHighRam(0xFF45) {
+// Update the coincidence flag in STAT and the STAT interrupt line, requesting
+// the STAT interrupt if the line has risen.
+func (gb *Gameboy) updateStat() {
+	ppu := &gb.ppu
+	status := gb.Memory.HighRAM[0x41]
+	coincidence := ppu.LYCompare == int(gb.Memory.ReadHighRam(0xFF45))
+	if coincidence {
 		status = bits.Set(status, 2)
-		// If enabled request an interrupt for this
-		if bits.Test(status, 6) {
-			gb.requestInterrupt(1)
-		}
 	} else {
 		status = bits.Reset(status, 2)
 	}
+	gb.Memory.HighRAM[0x41] = status
+
+	// Bits 3, 4 and 5 enable the interrupt for modes 0, 1 and 2. The mode 0
+	// interrupt is triggered as the last pixel is pushed, a dot before the mode
+	// changes. The mode 2 interrupt is also triggered at the start of VBlank,
+	// and its source stays active until the end of the first dot of the
+	// scanline.
+	mode := status & 0x3
+	oamScan := mode == 2 || (ppu.Line == ScreenHeight && ppu.Dot == 0)
+	hblank := mode == 0 || (mode == 3 && ppu.X == ScreenWidth)
+	line := (coincidence && bits.Test(status, 6)) ||
+		(hblank && bits.Test(status, 3)) ||
+		(mode == 1 && bits.Test(status, 4)) ||
+		(oamScan && bits.Test(status, 5))
+	if line && !ppu.StatLine {
+		gb.requestInterrupt(1)
+	}
+	ppu.StatLine = line
+}
 
-	gb.Memory.Write(0xFF41, status)
+// Reset the PPU while the LCD is disabled.
+func (gb *Gameboy) disableLCD() {
+	// set the screen to white
+	gb.clearScreen()
+
+	// The first scanline after the LCD is enabled starts part way through
+	// the OAM scan. The STAT interrupt line and coincidence flag are not
+	// updated while the LCD is disabled.
+	gb.ppu = ppuState{Dot: 4, StatLine: gb.ppu.StatLine}
+	gb.Memory.HighRAM[0x44] = 0
+	gb.Memory.HighRAM[0x41] &^= 0x3
 }
 
 // Checks if the LCD is enabled by examining 0xFF40.
@@ -127,107 +243,178 @@ func (gb *Gameboy) isLCDEnabled() bool {
 	return bits.Test(gb.Memory.ReadHighRam(LCDC), 7)
 }
 
-// Draw a single scanline to the graphics output.
-func (gb *Gameboy) drawScanline(scanline byte) {
-	control := gb.Memory.ReadHighRam(LCDC)
+// Start drawing a scanline at the start of mode 3.
+func (gb *Gameboy) startPixelTransfer(line byte) {
+	gb.setLCDMode(3)
+
+	ppu := &gb.ppu
+	ppu.X = -8
+	ppu.Discard = int(gb.Memory.ReadHighRam(0xFF43) % 8)
+	ppu.BGFIFO.clear()
+	ppu.SpriteFIFO.clear()
+	// The first tile fetched on the scanline is thrown away. Its tile number
+	// is not read, so it is fetched in 4 dots, and it is not counted in TileX.
+	ppu.Fetcher = pixelFetcher{Step: 2, TileX: 0xFF}
+	ppu.Sprites = gb.scanOAM(line)
+	ppu.NextSprite = 0
+	ppu.SpriteDots = 0
+}
 
-	// LCDC bit 0 clears tiles on DMG but controls priority on CGB.
-	if (gb.IsCGB() || bits.Test(control, 0)) && !gb.Debug.HideBackground {
-		gb.renderTiles(control, scanline)
+// Find the first 10 sprites in OAM which are on a scanline, ordered by their X
+// position. Sprites with the same X position stay in OAM order.
+func (gb *Gameboy) scanOAM(line byte) []lineSprite {
+	height := 8
+	if bits.Test(gb.Memory.ReadHighRam(LCDC), 2) {
+		height = 16
 	}
 
-	if bits.Test(control, 1) && !gb.Debug.HideSprites {
-		gb.renderSprites(control, int32(scanline))
+	sprites := gb.ppu.Sprites[:0]
+	for i := 0; i < 40 && len(sprites) < maxLineSprites; i++ {
+		y := int(gb.Memory.OAM[i*4])
+		if int(line)+16 < y || int(line)+16 >= y+height {
+			continue
+		}
+		sprites = append(sprites, lineSprite{
+			Y:        gb.Memory.OAM[i*4],
+			X:        gb.Memory.OAM[i*4+1],
+			Tile:     gb.Memory.OAM[i*4+2],
+			Attr:     gb.Memory.OAM[i*4+3],
+			OAMIndex: byte(i),
+		})
 	}
+	sort.SliceStable(sprites, func(i, j int) bool {
+		return sprites[i].X < sprites[j].X
+	})
+	return sprites
 }
 
-// Get settings to be used when rendering tiles.
-func (gb *Gameboy) getTileSettings(lcdControl byte, windowY byte) (
-	usingWindow bool,
-	unsigned bool,
-	tileData uint16,
-	backgroundMemory uint16,
-) {
-	tileData = uint16(0x8800)
-
-	if bits.Test(lcdControl, 5) {
-		// Is current scanline we're drawing within windows Y position?
-		if windowY <= gb.Memory.ReadHighRam(0xFF44) {
-			usingWindow = true
+// Advance the pixel transfer of mode 3 by a single dot. Pixels are pushed to
+// the LCD from the FIFOs as they are filled by the pixel fetcher, and the
+// output is stalled while sprites and the window are fetched, which lengthens
+// mode 3.
+func (gb *Gameboy) drawDot(line byte) {
+	ppu := &gb.ppu
+	gb.checkWindow()
+
+	if ppu.SpriteDots == 0 {
+		gb.tickFetcher(line)
+	}
+	if sprite := gb.nextSprite(); sprite != nil {
+		// The sprite is fetched once the background fetcher has nearly
+		// finished fetching its current tile
+		if ppu.SpriteDots == 0 && ppu.Fetcher.Step < 5 {
+			return
+		}
+		ppu.SpriteDots++
+		if ppu.SpriteDots == 6 {
+			gb.fetchSprite(*sprite, line)
+			ppu.NextSprite++
+			ppu.SpriteDots = 0
 		}
+		return
 	}
+	gb.pushPixel(line)
+}
 
-	// Test if we're using unsigned bytes
-	if bits.Test(lcdControl, 4) {
-		tileData = 0x8000
-		unsigned = true
+// Switch the fetcher to the window when it is reached on the scanline. The
+// background FIFO is cleared and the fetcher restarts from the first tile of
+// the window.
+func (gb *Gameboy) checkWindow() {
+	ppu := &gb.ppu
+	control := gb.Memory.ReadHighRam(LCDC)
+	if ppu.Fetcher.Window || !bits.Test(control, 5) || !ppu.WindowY || ppu.Discard > 0 || ppu.X < 0 {
+		return
 	}
 
-	// Work out where to look in background memory.
-	var testBit byte = 3
-	if usingWindow {
-		testBit = 6
-	}
-	backgroundMemory = uint16(0x9800)
-	if bits.Test(lcdControl, testBit) {
-		backgroundMemory = 0x9C00
+	windowX := int(gb.Memory.ReadHighRam(0xFF4B))
+	switch {
+	case ppu.WindowWrap:
+		// The window was started at the end of the previous scanline
+		ppu.WindowWrap = false
+	case ppu.X+7 < windowX:
+		return
+	case windowX < 7:
+		// The window starts off the left of the screen, so the pixels
+		// which would be off screen are discarded
+		ppu.Discard = 7 - windowX
+	case windowX == 166:
+		ppu.WindowWrap = true
 	}
-	return
+	ppu.BGFIFO.clear()
+	ppu.Fetcher = pixelFetcher{Window: true}
 }
 
-// Render a scanline of the tile map to the graphics output based
-// on the state of the lcdControl register.
-func (gb *Gameboy) renderTiles(lcdControl byte, scanline byte) {
-	scrollY := gb.Memory.ReadHighRam(0xFF42)
-	scrollX := gb.Memory.ReadHighRam(0xFF43)
-	windowY := gb.Memory.ReadHighRam(0xFF4A)
-	windowX := gb.Memory.ReadHighRam(0xFF4B) - 7
-
-	usingWindow, unsigned, tileData, backgroundMemory := gb.getTileSettings(lcdControl, windowY)
-
-	// yPos is used to calc which of 32 v-lines the current scanline is drawing
-	var yPos byte
-	if !usingWindow {
-		yPos = scrollY + scanline
-	} else {
-		yPos = scanline - windowY
+// Get the next sprite to fetch if it has been reached on the scanline.
+func (gb *Gameboy) nextSprite() *lineSprite {
+	ppu := &gb.ppu
+	if ppu.NextSprite >= len(ppu.Sprites) || ppu.BGFIFO.Size == 0 || ppu.Discard > 0 {
+		return nil
 	}
+	if !bits.Test(gb.Memory.ReadHighRam(LCDC), 1) {
+		return nil
+	}
+	sprite := &ppu.Sprites[ppu.NextSprite]
+	if int(sprite.X) > ppu.X+8 {
+		return nil
+	}
+	return sprite
+}
 
-	// which of the 8 vertical pixels of the current tile is the scanline on?
-	var tileRow = uint16(yPos/8) * 32
-
-	// Load the palette which will be used to draw the tiles
-	var palette = gb.Memory.ReadHighRam(0xFF47)
-
-	// start drawing the 160 horizontal pixels for this scanline
-	gb.tileScanline = [160]uint8{}
-	for pixel := byte(0); pixel < 160; pixel++ {
-		xPos := pixel + scrollX
-
-		// Translate the current x pos to window space if necessary
-		if usingWindow && pixel >= windowX {
-			xPos = pixel - windowX
+// Advance the background pixel fetcher by a single dot.
+func (gb *Gameboy) tickFetcher(line byte) {
+	ppu := &gb.ppu
+	fetcher := &ppu.Fetcher
+	if fetcher.Step >= 6 {
+		// Wait for the FIFO to empty before pushing the row of pixels
+		if ppu.BGFIFO.Size == 0 {
+			gb.pushTileRow()
+			fetcher.Step = 0
+			fetcher.TileX++
 		}
+		return
+	}
 
-		// Which of the 32 horizontal tiles does this x_pox fall within?
-		tileCol := uint16(xPos / 8)
+	fetcher.Step++
+	switch fetcher.Step {
+	case 2:
+		gb.fetchTileNum(line)
+	case 4:
+		fetcher.DataLo = gb.fetchTileData(line, 0)
+	case 6:
+		fetcher.DataHi = gb.fetchTileData(line, 1)
+	}
+}
 
-		// Get the tile identity number
-		tileAddress := backgroundMemory + tileRow + tileCol
+// Get the row of the background or window which the fetcher is fetching.
+func (gb *Gameboy) fetcherY(line byte) byte {
+	if gb.ppu.Fetcher.Window {
+		return gb.ppu.WindowLine
+	}
+	return line + gb.Memory.ReadHighRam(0xFF42)
+}
 
-		// Deduce where this tile id is in memory
-		tileLocation := tileData
-		if unsigned {
-			tileNum := int16(gb.Memory.VRAM[tileAddress-0x8000])
-			tileLocation = tileLocation + uint16(tileNum*16)
-		} else {
-			tileNum := int16(int8(gb.Memory.VRAM[tileAddress-0x8000]))
-			tileLocation = uint16(int32(tileLocation) + int32((tileNum+128)*16))
-		}
+// Fetch the number and CGB attributes of the next tile from the tile map.
+func (gb *Gameboy) fetchTileNum(line byte) {
+	fetcher := &gb.ppu.Fetcher
+	control := gb.Memory.ReadHighRam(LCDC)
 
-		bankOffset := uint16(0x8000)
+	// Work out where to look in the tile map
+	var mapBit byte = 3
+	tileX := gb.Memory.ReadHighRam(0xFF43)/8 + fetcher.TileX
+	if fetcher.Window {
+		mapBit = 6
+		tileX = fetcher.TileX
+	}
+	tileMap := uint16(0x9800)
+	if bits.Test(control, mapBit) {
+		tileMap = 0x9C00
+	}
+	address := tileMap + uint16(gb.fetcherY(line)/8)*32 + uint16(tileX%32)
 
-		// Attributes used in CGB mode TODO: check in CGB mode
+	fetcher.TileNum = gb.Memory.VRAM[address-0x8000]
+	fetcher.TileAttr = 0
+	if gb.IsCGB() {
+		// Attributes used in CGB mode, stored in VRAM bank 1
 		//
 		//    Bit 0-2  Background Palette number  (BGP0-7)
 		//    Bit 3    Tile VRAM Bank number      (0=Bank 0, 1=Bank 1)
@@ -235,170 +422,180 @@ func (gb *Gameboy) renderTiles(lcdControl byte, scanline byte) {
 		//    Bit 6    Vertical Flip              (0=Normal, 1=Mirror vertically)
 		//    Bit 7    BG-to-OAM Priority         (0=Use OAM priority bit, 1=BG Priority)
 		//
-		tileAttr := gb.Memory.VRAM[tileAddress-0x6000]
-		if gb.IsCGB() && bits.Test(tileAttr, 3) {
-			bankOffset = 0x6000
-		}
-		priority := bits.Test(tileAttr, 7)
-
-		var line byte
-		if gb.IsCGB() && bits.Test(tileAttr, 6) {
-			// Vertical flip
-			line = ((7 - yPos) % 8) * 2
-		} else {
-			line = (yPos % 8) * 2
-		}
-		// Get the tile data from memory
-		data1 := gb.Memory.VRAM[tileLocation+uint16(line)-bankOffset]
-		data2 := gb.Memory.VRAM[tileLocation+uint16(line)+1-bankOffset]
-
-		if gb.IsCGB() && bits.Test(tileAttr, 5) {
-			// Horizontal flip
-			xPos = 7 - xPos
-		}
-		colourBit := byte(int8((xPos%8)-7) * -1)
-		colourNum := (bits.Val(data2, colourBit) << 1) | bits.Val(data1, colourBit)
-		gb.setTilePixel(pixel, scanline, tileAttr, colourNum, palette, priority)
+		fetcher.TileAttr = gb.Memory.VRAM[address-0x6000]
 	}
 }
 
-func (gb *Gameboy) setTilePixel(x, y, tileAttr, colourNum, palette byte, priority bool) {
-	// Set the pixel
-	if gb.IsCGB() {
-		cgbPalette := tileAttr & 0x7
-		red, green, blue := gb.BGPalette.get(cgbPalette, colourNum)
-		gb.setPixel(x, y, red, green, blue, true)
-		gb.bgPriority[x][y] = priority
-	} else {
-		red, green, blue := gb.getColour(colourNum, palette)
-		gb.setPixel(x, y, red, green, blue, true)
+// Fetch the low (offset 0) or high (offset 1) byte of the tile data for the
+// row of the tile being fetched.
+func (gb *Gameboy) fetchTileData(line byte, offset uint16) byte {
+	fetcher := &gb.ppu.Fetcher
+	row := gb.fetcherY(line) % 8
+	if bits.Test(fetcher.TileAttr, 6) {
+		// Vertical flip
+		row = 7 - row
 	}
 
-	// Store for the current scanline so sprite priority can be managed
-	gb.tileScanline[x] = colourNum
+	// Test if we're using unsigned tile numbers
+	var address uint16
+	if bits.Test(gb.Memory.ReadHighRam(LCDC), 4) {
+		address = 0x8000 + uint16(fetcher.TileNum)*16
+	} else {
+		address = uint16(0x9000 + int(int8(fetcher.TileNum))*16)
+	}
+	address += uint16(row)*2 + offset
+	if bits.Test(fetcher.TileAttr, 3) {
+		address += 0x2000
+	}
+	return gb.Memory.VRAM[address-0x8000]
 }
 
-// Get the RGB colour value for a colour num at an address using the current palette.
-func (gb *Gameboy) getColour(colourNum byte, palette byte) (uint8, uint8, uint8) {
-	hi := colourNum<<1 | 1
-	lo := colourNum << 1
-	col := (bits.Val(palette, hi) << 1) | bits.Val(palette, lo)
-	return GetPaletteColour(col)
+// Push the row of 8 pixels which has been fetched to the background FIFO.
+func (gb *Gameboy) pushTileRow() {
+	fetcher := &gb.ppu.Fetcher
+	for i := byte(0); i < 8; i++ {
+		bit := 7 - i
+		if bits.Test(fetcher.TileAttr, 5) {
+			// Horizontal flip
+			bit = i
+		}
+		gb.ppu.BGFIFO.push(fifoPixel{
+			Colour:   bits.Val(fetcher.DataHi, bit)<<1 | bits.Val(fetcher.DataLo, bit),
+			Palette:  fetcher.TileAttr & 0x7,
+			Priority: bits.Test(fetcher.TileAttr, 7),
+		})
+	}
 }
 
-const spritePriorityOffset = 100
+// Fetch the row of a sprite on the scanline and mix it into the sprite FIFO.
+// Pixels already in the FIFO are only replaced where they are transparent, so
+// on the DMG the sprite with the smallest X position is drawn on top. On the
+// CGB the sprite which is first in OAM is drawn on top.
+func (gb *Gameboy) fetchSprite(sprite lineSprite, line byte) {
+	ppu := &gb.ppu
+	control := gb.Memory.ReadHighRam(LCDC)
 
-// Render the sprites to the screen on the current scanline using the lcdControl register.
-func (gb *Gameboy) renderSprites(lcdControl byte, scanline int32) {
-	var ySize int32 = 8
-	if bits.Test(lcdControl, 2) {
-		ySize = 16
+	var height byte = 8
+	tile := sprite.Tile
+	if bits.Test(control, 2) {
+		height = 16
+		tile &^= 1
 	}
 
-	// Load the two palettes which sprites can be drawn in
-	var palette1 = gb.Memory.ReadHighRam(0xFF48)
-	var palette2 = gb.Memory.ReadHighRam(0xFF49)
+	// Set the row to draw based on if the sprite is flipped on the y
+	row := line + 16 - sprite.Y
+	if bits.Test(sprite.Attr, 6) {
+		row = height - row - 1
+	}
 
-	var minx [ScreenWidth]int32
-	var lineSprites = 0
-	for sprite := uint16(0); sprite < 40; sprite++ {
-		// Load sprite data from memory.
-		index := sprite * 4
+	// Load the data containing the sprite data for this row, the bank is
+	// only selectable on the CGB
+	address := uint16(tile)*16 + uint16(row)*2
+	if gb.IsCGB() && bits.Test(sprite.Attr, 3) {
+		address += 0x2000
+	}
+	data1 := gb.Memory.VRAM[address]
+	data2 := gb.Memory.VRAM[address+1]
 
-		// If this is true the scanline is out of the area we care about
-		yPos := int32(gb.Memory.Read(uint16(0xFE00+index))) - 16
-		if scanline < yPos || scanline >= (yPos+ySize) {
-			continue
-		}
+	palette := (sprite.Attr >> 4) & 0x1
+	if gb.IsCGB() {
+		palette = sprite.Attr & 0x7
+	}
 
-		// Only 10 sprites are allowed to be displayed on each line
-		if lineSprites >= 10 {
-			break
+	for ppu.SpriteFIFO.Size < 8 {
+		ppu.SpriteFIFO.push(fifoPixel{})
+	}
+	// Skip the pixels of the sprite which are off the left of the screen
+	skip := ppu.X + 8 - int(sprite.X)
+	for i := skip; i < 8; i++ {
+		bit := byte(7 - i)
+		if bits.Test(sprite.Attr, 5) {
+			// Horizontal flip
+			bit = byte(i)
 		}
-		lineSprites++
-
-		xPos := int32(gb.Memory.Read(uint16(0xFE00+index+1))) - 8
-		tileLocation := gb.Memory.Read(uint16(0xFE00 + index + 2))
-		attributes := gb.Memory.Read(uint16(0xFE00 + index + 3))
-
-		yFlip := bits.Test(attributes, 6)
-		xFlip := bits.Test(attributes, 5)
-		priority := !bits.Test(attributes, 7)
-
-		// Bank the sprite data in is (CGB only)
-		var bank uint16 = 0
-		if gb.IsCGB() && bits.Test(attributes, 3) {
-			bank = 1
+		// Colour 0 is transparent for sprites
+		colour := bits.Val(data2, bit)<<1 | bits.Val(data1, bit)
+		if colour == 0 {
+			continue
 		}
-
-		// Set the line to draw based on if the sprite is flipped on the y
-		line := scanline - yPos
-		if yFlip {
-			line = ySize - line - 1
+		pixel := ppu.SpriteFIFO.at(i - skip)
+		if pixel.Colour != 0 && !(gb.IsCGB() && sprite.OAMIndex < pixel.OAMIndex) {
+			continue
 		}
+		*pixel = fifoPixel{
+			Colour:   colour,
+			Palette:  palette,
+			Priority: bits.Test(sprite.Attr, 7),
+			OAMIndex: sprite.OAMIndex,
+		}
+	}
+}
 
-		// Load the data containing the sprite data for this line
-		dataAddress := (uint16(tileLocation) * 16) + uint16(line*2) + (bank * 0x2000)
-		data1 := gb.Memory.VRAM[dataAddress]
-		data2 := gb.Memory.VRAM[dataAddress+1]
-
-		// Draw the line of the sprite
-		for tilePixel := byte(0); tilePixel < 8; tilePixel++ {
-			pixel := int16(xPos) + int16(7-tilePixel)
-			if pixel < 0 || pixel >= ScreenWidth {
-				continue
-			}
-
-			// Check if the pixel has priority.
-			//  - In DMG this is determined by the sprite with the smallest X coordinate,
-			//    then the first sprite in the OAM.
-			//  - In CGB this is determined by the first sprite appearing in the OAM.
-			// We add a fixed 100 to the xPos so we can use the 0 value as the absence of a sprite.
-			if minx[pixel] != 0 && (gb.IsCGB() || minx[pixel] <= xPos+spritePriorityOffset) {
-				continue
-			}
+// Push the next pixel from the FIFOs to the LCD.
+func (gb *Gameboy) pushPixel(line byte) {
+	ppu := &gb.ppu
+	if ppu.BGFIFO.Size == 0 {
+		return
+	}
+	bg := ppu.BGFIFO.pop()
+	var sprite fifoPixel
+	if ppu.SpriteFIFO.Size > 0 {
+		sprite = ppu.SpriteFIFO.pop()
+	}
+	if ppu.Discard > 0 {
+		ppu.Discard--
+		return
+	}
 
-			colourBit := tilePixel
-			if xFlip {
-				colourBit = byte(int8(colourBit-7) * -1)
-			}
+	if ppu.X >= 0 {
+		red, green, blue := gb.mixPixel(bg, sprite)
+		gb.screenData[ppu.X][line] = [3]uint8{red, green, blue}
+	}
+	ppu.X++
+}
 
-			// Find the colour value by combining the data bits
-			colourNum := (bits.Val(data2, colourBit) << 1) | bits.Val(data1, colourBit)
+// Get the colour of a pixel on the LCD from the background and sprite pixels.
+// The palette registers are read as the pixel is pushed, so they can be changed
+// part way through a scanline.
+func (gb *Gameboy) mixPixel(bg, sprite fifoPixel) (uint8, uint8, uint8) {
+	control := gb.Memory.ReadHighRam(LCDC)
 
-			// Colour 0 is transparent for sprites
-			if colourNum == 0 {
-				continue
-			}
+	// LCDC bit 0 clears the background on DMG but controls priority on CGB.
+	bgPalette := gb.Memory.ReadHighRam(0xFF47)
+	if gb.Debug.HideBackground || (!gb.IsCGB() && !bits.Test(control, 0)) {
+		bg.Colour, bgPalette = 0, 0
+	}
 
-			if gb.IsCGB() {
-				cgbPalette := attributes & 0x7
-				red, green, blue := gb.SpritePalette.get(cgbPalette, colourNum)
-				gb.setPixel(byte(pixel), byte(scanline), red, green, blue, priority)
-			} else {
-				// Determine the colour palette to use
-				var palette = palette1
-				if bits.Test(attributes, 4) {
-					palette = palette2
-				}
-				red, green, blue := gb.getColour(colourNum, palette)
-				gb.setPixel(byte(pixel), byte(scanline), red, green, blue, priority)
+	if sprite.Colour != 0 && bits.Test(control, 1) && !gb.Debug.HideSprites {
+		// Check if the background has priority over the sprite
+		behind := bg.Colour != 0 && (sprite.Priority || bg.Priority)
+		if gb.IsCGB() {
+			if !bits.Test(control, 0) || !behind {
+				return gb.SpritePalette.get(sprite.Palette, sprite.Colour)
 			}
-
-			// Store the xpos of the sprite for this pixel for priority resolution
-			minx[pixel] = xPos + spritePriorityOffset
+		} else if !behind {
+			palette := gb.Memory.ReadHighRam(0xFF48 + uint16(sprite.Palette))
+			return gb.getColour(sprite.Colour, palette, gb.SpritePalette, sprite.Palette)
 		}
 	}
+
+	if gb.IsCGB() {
+		return gb.BGPalette.get(bg.Palette, bg.Colour)
+	}
+	return gb.getColour(bg.Colour, bgPalette, gb.BGPalette, 0)
 }
 
-// Set a pixel in the graphics screen data.
-func (gb *Gameboy) setPixel(x byte, y byte, r uint8, g uint8, b uint8, priority bool) {
-	// If priority is false then sprite pixel is only set if tile colour is 0
-	if (priority && !gb.bgPriority[x][y]) || gb.tileScanline[x] == 0 {
-		gb.screenData[x][y][0] = r
-		gb.screenData[x][y][1] = g
-		gb.screenData[x][y][2] = b
+// Get the RGB colour value for a colour num using a DMG palette register. When
+// running a DMG game in CGB compatibility mode the colour is looked up in the
+// CGB palette set by the boot ROM, otherwise the current palette is used.
+func (gb *Gameboy) getColour(colourNum byte, palette byte, compat *cgbPalette, compatIndex byte) (uint8, uint8, uint8) {
+	hi := colourNum<<1 | 1
+	lo := colourNum << 1
+	col := (bits.Val(palette, hi) << 1) | bits.Val(palette, lo)
+	if gb.compatPalettes {
+		return compat.get(compatIndex, col)
 	}
+	return GetPaletteColour(col)
 }
 
 // Clear the screen by setting every pixel to white.
@@ -8,6 +8,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -70,3 +71,416 @@ func loadImage(filename string) (image.Image, error) {
 	}
 	return img, nil
 }
+
+// Create a Gameboy which is idle in a loop so that the PPU can be tested.
+func idleGameboy(t *testing.T) *Gameboy {
+	gb, err := NewGameboyFromROM(programROM(0x18, 0xFE))
+	require.NoError(t, err, "error in init gb %v", err)
+	return gb
+}
+
+// Run the PPU until it starts mode 3 on a scanline.
+func runUntilMode3(gb *Gameboy, line byte) {
+	for gb.Memory.HighRAM[0x44] != line || gb.lcdMode() != 3 {
+		gb.updateDot()
+	}
+}
+
+// Measure the number of dots in mode 3 on line 1.
+func mode3Length(gb *Gameboy) int {
+	runUntilMode3(gb, 1)
+	dots := 0
+	for gb.lcdMode() == 3 {
+		gb.updateDot()
+		dots++
+	}
+	return dots
+}
+
+// TestPPU_Mode3Length asserts that the length of mode 3 depends on the fine
+// scroll, sprites and the window on the scanline.
+func TestPPU_Mode3Length(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(gb *Gameboy)
+		dots  int
+	}{
+		{"no penalty", func(gb *Gameboy) {}, 172},
+		{"scx", func(gb *Gameboy) { gb.Memory.Write(0xFF43, 3) }, 175},
+		{"sprite at 0", func(gb *Gameboy) {
+			gb.Memory.OAM[0], gb.Memory.OAM[1] = 17, 8
+		}, 183},
+		{"sprite at 4", func(gb *Gameboy) {
+			gb.Memory.OAM[0], gb.Memory.OAM[1] = 17, 12
+		}, 179},
+		{"sprites disabled", func(gb *Gameboy) {
+			gb.Memory.OAM[0], gb.Memory.OAM[1] = 17, 8
+			gb.Memory.Write(LCDC, 0x91&^0x02)
+		}, 172},
+		{"window", func(gb *Gameboy) {
+			gb.Memory.Write(LCDC, 0x91|0x20)
+			gb.Memory.Write(0xFF4B, 87)
+		}, 178},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gb := idleGameboy(t)
+			gb.Memory.Write(LCDC, 0x91|0x02)
+			test.setup(gb)
+			assert.Equal(t, test.dots, mode3Length(gb))
+		})
+	}
+}
+
+// TestPPU_MidScanlinePalette asserts that changing the palette part way through
+// drawing a scanline only affects the pixels which are drawn afterwards.
+func TestPPU_MidScanlinePalette(t *testing.T) {
+	gb := idleGameboy(t)
+	gb.Memory.Write(0xFF47, 0x00)
+	runUntilMode3(gb, 0)
+
+	// The first pixel is pushed on the 13th dot of mode 3, and the first dot
+	// of mode 3 has already been run
+	for i := 0; i < 11+80; i++ {
+		gb.updateDot()
+	}
+	gb.Memory.Write(0xFF47, 0xFF)
+	for gb.lcdMode() == 3 {
+		gb.updateDot()
+	}
+
+	white := [3]uint8{}
+	white[0], white[1], white[2] = GetPaletteColour(0)
+	black := [3]uint8{}
+	black[0], black[1], black[2] = GetPaletteColour(3)
+	for x := 0; x < ScreenWidth; x++ {
+		expected := white
+		if x >= 80 {
+			expected = black
+		}
+		require.Equal(t, expected, gb.screenData[x][0], "incorrect pixel at X:%v", x)
+	}
+}
+
+// Create a Gameboy with the window enabled using the tile map at 0x9C00. Tile
+// 1 is filled with colour 3 and tile 2 has its left half filled with colour 3.
+func windowGameboy(t *testing.T) *Gameboy {
+	gb := idleGameboy(t)
+	for i := 0; i < 16; i++ {
+		gb.Memory.VRAM[0x10+i] = 0xFF
+		gb.Memory.VRAM[0x20+i] = 0xF0
+	}
+	gb.Memory.Write(LCDC, 0x91|0x20|0x40)
+	gb.Memory.Write(0xFF4A, 0)
+	gb.Memory.Write(0xFF4B, 7)
+	return gb
+}
+
+// Run the PPU until the end of the frame, calling a function at the start of
+// each scanline.
+func runFrame(gb *Gameboy, onLine func(line byte)) {
+	for {
+		if gb.ppu.Dot == 0 {
+			line := gb.ppu.Line
+			if line == ScreenHeight {
+				return
+			}
+			onLine(line)
+		}
+		gb.updateDot()
+	}
+}
+
+// Assert that each line of a column of the frame is black or white.
+func assertColumn(t *testing.T, gb *Gameboy, x int, black func(line int) bool) {
+	for y := 0; y < ScreenHeight; y++ {
+		expected := [3]uint8{}
+		if black(y) {
+			expected[0], expected[1], expected[2] = GetPaletteColour(3)
+		} else {
+			expected[0], expected[1], expected[2] = GetPaletteColour(0)
+		}
+		require.Equal(t, expected, gb.PreparedData[x][y], "incorrect pixel at X:%v Y:%v", x, y)
+	}
+}
+
+// TestPPU_WindowLineCounter asserts that hiding the window part way through a
+// frame does not skip any of the rows of the window.
+func TestPPU_WindowLineCounter(t *testing.T) {
+	gb := windowGameboy(t)
+	// Every other row of tiles in the window is black
+	for row := 1; row < 32; row += 2 {
+		for col := 0; col < 32; col++ {
+			gb.Memory.VRAM[0x1C00+row*32+col] = 1
+		}
+	}
+
+	runFrame(gb, func(line byte) {
+		switch line {
+		case 4:
+			gb.Memory.Write(LCDC, 0x91|0x40)
+		case 12:
+			gb.Memory.Write(LCDC, 0x91|0x20|0x40)
+		}
+	})
+	assertColumn(t, gb, 0, func(line int) bool {
+		if line >= 4 && line < 12 {
+			return false
+		}
+		row := line
+		if line >= 12 {
+			row -= 8
+		}
+		return (row/8)%2 == 1
+	})
+}
+
+// TestPPU_WindowY asserts that the window is drawn for the rest of the frame
+// once LY has matched WY, even if WY is then changed.
+func TestPPU_WindowY(t *testing.T) {
+	gb := windowGameboy(t)
+	for i := 0; i < 0x400; i++ {
+		gb.Memory.VRAM[0x1C00+i] = 1
+	}
+	gb.Memory.Write(0xFF4A, 10)
+
+	runFrame(gb, func(line byte) {
+		if line == 20 {
+			gb.Memory.Write(0xFF4A, 50)
+		}
+	})
+	assertColumn(t, gb, 0, func(line int) bool {
+		return line >= 10
+	})
+}
+
+// TestPPU_WindowX asserts that the window is shifted off the left of the screen
+// when WX is less than 7, and wraps onto the next scanline when WX is 166.
+func TestPPU_WindowX(t *testing.T) {
+	gb := windowGameboy(t)
+	for i := 0; i < 0x400; i++ {
+		gb.Memory.VRAM[0x1C00+i] = 2
+	}
+	gb.Memory.Write(0xFF4B, 3)
+	runFrame(gb, func(byte) {})
+	for x := 0; x < 16; x++ {
+		black := x%8 >= 4
+		assertColumn(t, gb, x, func(int) bool { return black })
+	}
+
+	gb = windowGameboy(t)
+	for i := 0; i < 0x400; i++ {
+		gb.Memory.VRAM[0x1C00+i] = 1
+	}
+	gb.Memory.Write(0xFF4B, 166)
+	runFrame(gb, func(line byte) {
+		if line == 2 {
+			gb.Memory.Write(0xFF4B, 167)
+		}
+	})
+	for x := 0; x < ScreenWidth; x++ {
+		onFirstLine := x == ScreenWidth-1
+		assertColumn(t, gb, x, func(line int) bool {
+			return line == 1 || (line == 0 && onFirstLine)
+		})
+	}
+}
+
+// TestPPU_WindowLCDOn asserts that the window is drawn from the first scanline
+// after the LCD is enabled when WY is 0.
+func TestPPU_WindowLCDOn(t *testing.T) {
+	gb := windowGameboy(t)
+	for i := 0; i < 0x400; i++ {
+		gb.Memory.VRAM[0x1C00+i] = 1
+	}
+	control := gb.Memory.ReadHighRam(LCDC)
+	gb.Memory.Write(LCDC, control&^0x80)
+	gb.updateGraphics(4)
+	gb.Memory.Write(LCDC, control)
+	gb.updateGraphics(4)
+
+	runFrame(gb, func(byte) {})
+	assertColumn(t, gb, 0, func(int) bool { return true })
+}
+
+// TestPPU_WindowImage runs a program which draws a checkered window, hides it
+// part way down the screen and then shows it again further to the right, and
+// asserts that the output frame matches the expected image. The window should
+// carry on from the row it was hidden on.
+func TestPPU_WindowImage(t *testing.T) {
+	rom := programROM(0xC3, 0x50, 0x01) // JP 0x150
+	// VBlank and STAT interrupt vectors
+	copy(rom[0x40:], []byte{0xC3, 0x00, 0x02}) // JP 0x200
+	copy(rom[0x48:], []byte{0xC3, 0x10, 0x02}) // JP 0x210
+	copy(rom[0x150:], []byte{
+		0xF3,             // DI
+		0x31, 0xFE, 0xFF, // LD SP,0xFFFE
+		0xF0, 0x44, // LDH A,(LY)
+		0xFE, 0x90, // CP 144
+		0x38, 0xFA, // JR C,-6
+		0xAF,       // XOR A
+		0xE0, 0x40, // LDH (LCDC),A
+
+		// Fill tile 1 with colour 3
+		0x21, 0x10, 0x80, // LD HL,0x8010
+		0x3E, 0xFF, // LD A,0xFF
+		0x06, 0x10, // LD B,16
+		0x22,       // LD (HL+),A
+		0x05,       // DEC B
+		0x20, 0xFC, // JR NZ,-4
+
+		// Clear both tile maps
+		0x21, 0x00, 0x98, // LD HL,0x9800
+		0xAF,       // XOR A
+		0x22,       // LD (HL+),A
+		0x7C,       // LD A,H
+		0xFE, 0xA0, // CP 0xA0
+		0x20, 0xF9, // JR NZ,-7
+
+		// Checker the window tile map with tiles 0 and 1
+		0x21, 0x00, 0x9C, // LD HL,0x9C00
+		0x7D,       // LD A,L
+		0xCB, 0x37, // SWAP A
+		0x0F,       // RRCA
+		0xAD,       // XOR L
+		0xE6, 0x01, // AND 1
+		0x22,       // LD (HL+),A
+		0x7C,       // LD A,H
+		0xFE, 0xA0, // CP 0xA0
+		0x20, 0xF3, // JR NZ,-13
+
+		0x3E, 0xE4, // LD A,0xE4
+		0xE0, 0x47, // LDH (BGP),A
+		0x3E, 0x10, // LD A,16
+		0xE0, 0x4A, // LDH (WY),A
+		0x3E, 0x2F, // LD A,47
+		0xE0, 0x4B, // LDH (WX),A
+		0x3E, 0x4F, // LD A,79
+		0xE0, 0x45, // LDH (LYC),A
+		0x3E, 0x40, // LD A,0x40
+		0xE0, 0x41, // LDH (STAT),A
+		0x3E, 0x03, // LD A,3
+		0xE0, 0xFF, // LDH (IE),A
+		0xAF,       // XOR A
+		0xE0, 0x0F, // LDH (IF),A
+		0x3E, 0xF1, // LD A,0xF1
+		0xE0, 0x40, // LDH (LCDC),A
+		0xFB,       // EI
+		0x76,       // HALT
+		0x18, 0xFD, // JR -3
+	})
+	// Reset the window position and LYC for the next frame in VBlank
+	copy(rom[0x200:], []byte{
+		0x3E, 0x2F, // LD A,47
+		0xE0, 0x4B, // LDH (WX),A
+		0x3E, 0x4F, // LD A,79
+		0xE0, 0x45, // LDH (LYC),A
+		0xD9, // RETI
+	})
+	// Wait for HBlank, then hide the window after line 79 and show it again
+	// further right after line 103
+	copy(rom[0x210:], []byte{
+		0xF0, 0x41, // LDH A,(STAT)
+		0xE6, 0x03, // AND 3
+		0x20, 0xFA, // JR NZ,-6
+		0xF0, 0x45, // LDH A,(LYC)
+		0xFE, 0x4F, // CP 79
+		0x20, 0x09, // JR NZ,9
+		0x3E, 0xD1, // LD A,0xD1
+		0xE0, 0x40, // LDH (LCDC),A
+		0x3E, 0x67, // LD A,103
+		0xE0, 0x45, // LDH (LYC),A
+		0xD9,       // RETI
+		0x3E, 0xF1, // LD A,0xF1
+		0xE0, 0x40, // LDH (LCDC),A
+		0x3E, 0x57, // LD A,87
+		0xE0, 0x4B, // LDH (WX),A
+		0xD9, // RETI
+	})
+
+	gb, err := NewGameboyFromROM(rom)
+	require.NoError(t, err, "error in init gb %v", err)
+	for i := 0; i < 3; i++ {
+		gb.Update()
+	}
+
+	img, err := loadImage("testdata/window-expected.png")
+	require.NoError(t, err, "could not open expected image")
+
+	colours := map[color.Color]byte{
+		color.Gray{Y: 255}: 0,
+		color.Gray{Y: 0}:   3,
+	}
+	for x := 0; x < ScreenWidth; x++ {
+		for y := 0; y < ScreenHeight; y++ {
+			colour, ok := colours[img.At(x, y)]
+			require.True(t, ok, "unexpected colour in expected image: %v", img.At(x, y))
+			expected := [3]uint8{}
+			expected[0], expected[1], expected[2] = GetPaletteColour(colour)
+			require.Equal(t, expected, gb.PreparedData[x][y], "incorrect pixel at X:%v Y:%v", x, y)
+		}
+	}
+}
+
+// TestPPU_StatBlocking asserts that the STAT interrupt is only requested on a
+// rising edge of the STAT line, so a second source becoming active while the
+// line is already high does not request another interrupt.
+func TestPPU_StatBlocking(t *testing.T) {
+	gb := idleGameboy(t)
+	gb.Memory.Write(0xFF41, 0x08|0x20)
+	runUntilMode3(gb, 1)
+	for gb.lcdMode() != 0 {
+		gb.updateDot()
+	}
+	gb.Memory.Write(0xFF0F, 0)
+	for gb.lcdMode() != 3 {
+		gb.updateDot()
+	}
+	assert.Equal(t, byte(0), gb.Memory.Read(0xFF0F)&0x02, "mode 2 should be blocked by mode 0")
+
+	gb.Memory.Write(0xFF41, 0x08)
+	for gb.lcdMode() != 0 {
+		gb.updateDot()
+	}
+	assert.Equal(t, byte(0x02), gb.Memory.Read(0xFF0F)&0x02, "mode 0 should request an interrupt")
+}
+
+// TestPPU_LY153 asserts that LY reads as 0 for most of line 153 and that the
+// LY=LYC comparison with 0 is made part way through the line.
+func TestPPU_LY153(t *testing.T) {
+	gb := idleGameboy(t)
+	gb.Memory.Write(0xFF45, 0)
+	for gb.ppu.Line != 153 {
+		gb.updateDot()
+	}
+	for gb.ppu.Dot < 16 {
+		gb.updateDot()
+	}
+	assert.Equal(t, byte(0), gb.Memory.Read(0xFF44))
+	assert.Equal(t, byte(0x04), gb.Memory.Read(0xFF41)&0x04, "coincidence flag should be set")
+}
+
+// TestPPU_AccessRestrictions asserts that the CPU cannot access OAM during
+// modes 2 and 3 or VRAM during mode 3, unless the restrictions are disabled.
+func TestPPU_AccessRestrictions(t *testing.T) {
+	gb := idleGameboy(t)
+	gb.Memory.VRAM[0] = 0x12
+	gb.Memory.OAM[0] = 0x34
+	for gb.lcdMode() != 2 {
+		gb.updateDot()
+	}
+	assert.Equal(t, byte(0x12), gb.Memory.Read(0x8000))
+	assert.Equal(t, byte(0xFF), gb.Memory.Read(0xFE00), "oam should be blocked in mode 2")
+	gb.Memory.Write(0xFE00, 0x56)
+	assert.Equal(t, byte(0x34), gb.Memory.OAM[0], "oam write should be ignored in mode 2")
+
+	runUntilMode3(gb, gb.ppu.Line)
+	assert.Equal(t, byte(0xFF), gb.Memory.Read(0x8000), "vram should be blocked in mode 3")
+	assert.Equal(t, byte(0xFF), gb.Memory.Read(0xFE00), "oam should be blocked in mode 3")
+	gb.Memory.Write(0x8000, 0x56)
+	assert.Equal(t, byte(0x12), gb.Memory.VRAM[0], "vram write should be ignored in mode 3")
+
+	gb.options.unrestrictedAccess = true
+	assert.Equal(t, byte(0x12), gb.Memory.Read(0x8000))
+	assert.Equal(t, byte(0x34), gb.Memory.Read(0xFE00))
+}
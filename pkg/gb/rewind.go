@@ -0,0 +1,201 @@
+package gb
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+)
+
+// rewindBuffer is a bounded ring buffer of snapshots of the Gameboy which are
+// used to step execution backwards.
+//
+// To keep the memory usage low the snapshots are reverse delta encoded. The
+// newest snapshot is kept in full, and each older snapshot is stored as the
+// compressed XOR of itself and the snapshot after it. Rewinding walks back from
+// the newest snapshot, and the oldest snapshot can be dropped at any time
+// without needing to re-encode the rest of the buffer.
+type rewindBuffer struct {
+	// Number of frames between each snapshot.
+	interval int
+	// Maximum number of bytes that can be used by the stored snapshots.
+	maxBytes int
+
+	// Frames since the last snapshot was taken.
+	frames int
+
+	// Full encoding of the newest snapshot.
+	newest []byte
+	// Compressed deltas of the older snapshots, ordered oldest first.
+	deltas [][]byte
+	size   int
+}
+
+// Create a new rewind buffer which takes a snapshot every interval frames and
+// uses at most maxBytes of memory.
+func newRewindBuffer(interval, maxBytes int) *rewindBuffer {
+	if interval < 1 {
+		interval = 1
+	}
+	return &rewindBuffer{
+		interval: interval,
+		maxBytes: maxBytes,
+	}
+}
+
+// Push a new snapshot onto the buffer, evicting the oldest snapshots if the
+// buffer has grown past its memory limit.
+func (buf *rewindBuffer) push(snapshot []byte) error {
+	if buf.newest != nil {
+		delta, err := compressDelta(buf.newest, snapshot)
+		if err != nil {
+			return err
+		}
+		buf.deltas = append(buf.deltas, delta)
+		buf.size += len(delta) - len(buf.newest)
+	}
+	buf.newest = snapshot
+	buf.size += len(snapshot)
+	buf.frames = 0
+
+	for buf.size > buf.maxBytes && len(buf.deltas) > 0 {
+		buf.size -= len(buf.deltas[0])
+		buf.deltas[0] = nil
+		buf.deltas = buf.deltas[1:]
+	}
+	return nil
+}
+
+// Pop the newest snapshot off the buffer, making the snapshot before it the
+// newest. Returns false if there are no older snapshots.
+func (buf *rewindBuffer) pop() (bool, error) {
+	if len(buf.deltas) == 0 {
+		return false, nil
+	}
+	last := len(buf.deltas) - 1
+	previous, err := decompressDelta(buf.deltas[last], buf.newest)
+	if err != nil {
+		return false, err
+	}
+	buf.size -= len(buf.deltas[last]) + len(buf.newest) - len(previous)
+	buf.deltas = buf.deltas[:last]
+	buf.newest = previous
+	return true, nil
+}
+
+// Compress the difference between a snapshot and the snapshot after it.
+func compressDelta(snapshot, next []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := flate.NewWriter(&out, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(xorBytes(snapshot, next)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Restore a snapshot from its compressed delta and the snapshot after it.
+func decompressDelta(delta, next []byte) ([]byte, error) {
+	diff, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(delta)))
+	if err != nil {
+		return nil, err
+	}
+	return xorBytes(diff, next), nil
+}
+
+// XOR a value with a key. The result is the same length as the value, and any
+// bytes past the end of the key are copied as they are. Applying the function
+// twice with the same key returns the original value.
+func xorBytes(value, key []byte) []byte {
+	out := make([]byte, len(value))
+	copy(out, value)
+	for i := 0; i < len(out) && i < len(key); i++ {
+		out[i] ^= key[i]
+	}
+	return out
+}
+
+// Record a snapshot in the rewind buffer if enough frames have passed.
+func (gb *Gameboy) updateRewind() error {
+	buf := gb.rewind
+	buf.frames++
+	if buf.frames < buf.interval {
+		return nil
+	}
+	snapshot, err := gb.encodeSnapshot()
+	if err != nil {
+		return err
+	}
+	return buf.push(snapshot)
+}
+
+// Rewind steps the Gameboy back by at least the number of frames, or as far
+// back as the rewind buffer allows. Snapshots are only taken at an interval,
+// so the returned number of frames actually rewound may be larger than the
+// number requested. Rewinding must be enabled with the WithRewind option.
+func (gb *Gameboy) Rewind(frames int) (int, error) {
+	buf := gb.rewind
+	if buf == nil {
+		return 0, fmt.Errorf("rewind is not enabled")
+	}
+	if buf.newest == nil {
+		return 0, nil
+	}
+
+	// Walk back until we reach a snapshot which is far enough in the past
+	rewound := buf.frames
+	for rewound < frames {
+		ok, err := buf.pop()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		rewound += buf.interval
+	}
+
+	if err := gb.decodeSnapshot(buf.newest); err != nil {
+		return 0, err
+	}
+	buf.frames = 0
+	return rewound, nil
+}
+
+// Toggle the rewinding state on when the rewind button is held.
+func (gb *Gameboy) startRewinding() {
+	gb.rewinding = gb.rewind != nil
+}
+
+// Toggle the rewinding state off when the rewind button is released.
+func (gb *Gameboy) stopRewinding() {
+	gb.rewinding = false
+}
+
+// Encode the current state of the Gameboy as a snapshot.
+func (gb *Gameboy) encodeSnapshot() ([]byte, error) {
+	state, err := gb.getState()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Restore the state of the Gameboy from a snapshot.
+func (gb *Gameboy) decodeSnapshot(snapshot []byte) error {
+	var state gameboyState
+	if err := gob.NewDecoder(bytes.NewReader(snapshot)).Decode(&state); err != nil {
+		return err
+	}
+	return gb.setState(&state)
+}
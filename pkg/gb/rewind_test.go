@@ -0,0 +1,67 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRewindBuffer asserts that snapshots of differing lengths can be pushed
+// and popped from the buffer.
+func TestRewindBuffer(t *testing.T) {
+	snapshots := [][]byte{
+		{1, 2, 3, 4},
+		{1, 2, 3, 5, 6},
+		{7, 2},
+		{7, 2, 3, 4, 5, 6, 7},
+	}
+	buf := newRewindBuffer(1, 1<<20)
+	for _, snapshot := range snapshots {
+		require.NoError(t, buf.push(snapshot))
+	}
+
+	for i := len(snapshots) - 1; i > 0; i-- {
+		assert.Equal(t, snapshots[i], buf.newest)
+		ok, err := buf.pop()
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	assert.Equal(t, snapshots[0], buf.newest)
+	ok, err := buf.pop()
+	require.NoError(t, err)
+	assert.False(t, ok, "should not pop past the oldest snapshot")
+}
+
+// TestRewindBuffer_Limit asserts that the oldest snapshots are evicted when the
+// buffer grows past its memory limit.
+func TestRewindBuffer_Limit(t *testing.T) {
+	buf := newRewindBuffer(1, 200)
+	for i := 0; i < 100; i++ {
+		snapshot := make([]byte, 50)
+		snapshot[i%50] = byte(i)
+		require.NoError(t, buf.push(snapshot))
+		assert.True(t, buf.size <= 200, "buffer is larger than limit: %v", buf.size)
+	}
+	assert.NotEmpty(t, buf.deltas)
+}
+
+// TestRewind asserts that rewinding the Gameboy returns it to the state it
+// was in that many frames ago.
+func TestRewind(t *testing.T) {
+	gb, err := NewGameboy("./../../roms/blargg/cpu_instrs.gb", WithRewind(1, 1<<24))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	for i := 0; i < 50; i++ {
+		gb.Update()
+	}
+	expected := *gb.CPU
+	for i := 0; i < 10; i++ {
+		gb.Update()
+	}
+
+	rewound, err := gb.Rewind(10)
+	require.NoError(t, err)
+	assert.Equal(t, 10, rewound)
+	assert.Equal(t, expected, *gb.CPU, "cpu state does not match")
+}
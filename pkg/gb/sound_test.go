@@ -0,0 +1,140 @@
+package gb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/apu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Maximum number of frames to run a blargg sound test rom for.
+const maxSoundFrames = 3000
+
+// The single test roms of the blargg dmg_sound and cgb_sound suites. The roms
+// are the same in both suites apart from the last one.
+var soundTestROMs = []string{
+	"01-registers",
+	"02-len ctr",
+	"03-trigger",
+	"04-sweep",
+	"05-sweep details",
+	"06-overflow on trigger",
+	"07-len sweep period sync",
+	"08-len ctr during power",
+	"09-wave read while on",
+	"10-wave trigger while on",
+	"11-regs after power",
+}
+
+// Sound test roms which are known to fail, keyed by the suite and the name of
+// the rom. These are skipped so that regressions in the other roms are caught.
+var soundKnownFailures = map[string]bool{}
+
+// Run the blargg sound test roms of a suite. The roms are checked in to
+// roms/blargg/<suite>, and each missing rom fails its sub-test by name.
+func runSoundTests(t *testing.T, suite string, roms []string, options ...GameboyOption) {
+	for _, name := range roms {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join("./../../roms/blargg", suite, name+".gb")
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				t.Fatalf("test rom %v is missing", file)
+			}
+			if soundKnownFailures[suite+"/"+name] {
+				t.Skip("known failure")
+			}
+
+			gb, err := NewGameboy(file, options...)
+			require.NoError(t, err, "error in init gb %v", err)
+
+			// The result is written to the cartridge RAM once the test has
+			// finished, after a signature which shows that it is valid
+			for i := 0; i < maxSoundFrames && !blarggFinished(gb); i++ {
+				gb.Update()
+			}
+			require.True(t, blarggFinished(gb), "test did not finish")
+			assert.Equal(t, byte(0), gb.Memory.Read(0xA000), blarggOutput(gb))
+		})
+	}
+}
+
+// Check if a blargg test rom has written its result to the cartridge RAM.
+func blarggFinished(gb *Gameboy) bool {
+	return gb.Memory.Read(0xA001) == 0xDE &&
+		gb.Memory.Read(0xA002) == 0xB0 &&
+		gb.Memory.Read(0xA003) == 0x61 &&
+		gb.Memory.Read(0xA000) != 0x80
+}
+
+// Get the text output of a blargg test rom from the cartridge RAM.
+func blarggOutput(gb *Gameboy) string {
+	var out strings.Builder
+	for address := uint16(0xA004); address < 0xC000; address++ {
+		char := gb.Memory.Read(address)
+		if char == 0 {
+			break
+		}
+		out.WriteByte(char)
+	}
+	return out.String()
+}
+
+// TestSound_DMG runs the blargg dmg_sound test roms on the DMG.
+func TestSound_DMG(t *testing.T) {
+	roms := append(append([]string{}, soundTestROMs...), "12-wave write while on")
+	runSoundTests(t, "dmg_sound", roms, WithModel(ModelDMG))
+}
+
+// TestSound_CGB runs the blargg cgb_sound test roms on the CGB.
+func TestSound_CGB(t *testing.T) {
+	roms := append(append([]string{}, soundTestROMs...), "12-wave")
+	runSoundTests(t, "cgb_sound", roms, WithModel(ModelCGB))
+}
+
+// TestSound_FrameSequencer asserts that the frame sequencer is stepped by DIV,
+// so that a channel with a length of 1 is disabled after 1/256 of a second.
+func TestSound_FrameSequencer(t *testing.T) {
+	gb, err := NewGameboyFromROM(programROM(0x18, 0xFE))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	gb.Memory.Write(0xFF16, 0x3F)
+	gb.Memory.Write(0xFF17, 0xF0)
+	gb.Memory.Write(0xFF19, 0xC0)
+	assert.Equal(t, byte(0x02), gb.Memory.Read(0xFF26)&0x02, "channel 2 should be playing")
+
+	gb.RunCycles(CyclesFrame / 2)
+	assert.Equal(t, byte(0), gb.Memory.Read(0xFF26)&0x02, "channel 2 length should expire")
+}
+
+// TestSound_AudioSink asserts that the audio of each frame is pushed to the
+// sink by the end of the update.
+func TestSound_AudioSink(t *testing.T) {
+	sink := &apu.MemorySink{}
+	gb, err := NewGameboyFromROM(programROM(0x18, 0xFE), WithAudioSink(sink))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	// The first frame is shorter as it ends at the first VBlank
+	gb.Update()
+	sink.Frames = nil
+
+	const frames = 10
+	for i := 0; i < frames; i++ {
+		gb.Update()
+	}
+	expected := float64(frames*CyclesFrame) / ClockSpeed * apu.SampleRate
+	assert.InDelta(t, expected, len(sink.Frames), 1)
+}
+
+// TestSound_RecordingName asserts that the names of recordings are safe to use
+// as file names.
+func TestSound_RecordingName(t *testing.T) {
+	assert.Equal(t, "POKEMON_RED", recordingName("POKEMON RED"))
+	assert.Equal(t, "___etc_passwd", recordingName("../etc/passwd"))
+	assert.Equal(t, "A_B_C", recordingName(`A\B:C`))
+	assert.Equal(t, "goboy", recordingName(""))
+	assert.Equal(t, "goboy", recordingName("???"))
+}
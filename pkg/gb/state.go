@@ -0,0 +1,411 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// Magic bytes written at the start of every save state.
+	stateMagic = "GOBOYSS"
+	// Version of the save state format. This should be incremented whenever the
+	// meaning of the stored state changes so that older states can be upgraded
+	// when they are loaded. Fields which are added or removed do not require a
+	// new version as gob ignores fields missing from either side, but gob
+	// cannot decode a field whose type has changed so that also requires a new
+	// version and a legacy type to decode the older states into.
+	stateVersion uint16 = 4
+)
+
+// State of the Gameboy which is written to a save state.
+type gameboyState struct {
+	CartTitle string
+
+	CPU    cpuState
+	Memory memoryState
+	Timer  timerState
+
+	// PPU state. The screen matrices are flattened as gob is very slow
+	// at encoding nested arrays.
+	PPU           ppuState
+	ScreenData    []byte
+	ScreenCleared bool
+	PreparedData  []byte
+	// Only used to upgrade states older than version 3.
+	ScanlineCounter int
+
+	InterruptsEnabling bool
+	InterruptsOn       bool
+	Halted             bool
+	HaltBug            bool
+	Stopped            bool
+
+	InputMask      byte
+	CGBMode        bool
+	DMGCompat      bool
+	CompatPalettes bool
+	BGPalette      cgbPalette
+	SpritePalette  cgbPalette
+	CurrentSpeed   byte
+	PrepareSpeed   bool
+
+	Sound []byte
+	Cart  []byte
+}
+
+// State written by version 1 of the save state format, which stored the
+// screen matrices as arrays. Only the fields which are used by the current
+// state are decoded.
+type gameboyStateV1 struct {
+	CartTitle string
+
+	CPU    cpuState
+	Memory memoryState
+
+	ScanlineCounter int
+	ScreenData      [ScreenWidth][ScreenHeight][3]uint8
+	ScreenCleared   bool
+	PreparedData    [ScreenWidth][ScreenHeight][3]uint8
+
+	InterruptsEnabling bool
+	InterruptsOn       bool
+	Halted             bool
+
+	InputMask     byte
+	CGBMode       bool
+	BGPalette     cgbPalette
+	SpritePalette cgbPalette
+	CurrentSpeed  byte
+	PrepareSpeed  bool
+
+	Sound []byte
+	Cart  []byte
+}
+
+// State of the CPU registers.
+type cpuState struct {
+	AF, BC, DE, HL, SP uint16
+	PC                 uint16
+}
+
+// State of the memory and banking.
+type memoryState struct {
+	HighRAM  [0x100]byte
+	VRAM     [0x4000]byte
+	VRAMBank byte
+	WRAM     [0x9000]byte
+	WRAMBank byte
+	OAM      [0x100]byte
+
+	HDMALength byte
+	HDMAActive bool
+	HDMAStall  int
+
+	DMAActive      bool
+	DMASource      uint16
+	DMAIndex       uint16
+	DMAValue       byte
+	DMAStarting    int
+	DMAStartSource uint16
+
+	BootROMEnabled bool
+}
+
+// State of the timer.
+type timerState struct {
+	Counter    uint16
+	TIMA       byte
+	TMA        byte
+	TAC        byte
+	Overflowed bool
+	Reloading  bool
+}
+
+// SaveState writes a snapshot of the full state of the Gameboy to the writer.
+// The snapshot can be restored with LoadState to resume execution from
+// exactly the same point.
+func (gb *Gameboy) SaveState(w io.Writer) error {
+	if !gb.IsGameLoaded() {
+		return errors.New("no game loaded")
+	}
+	state, err := gb.getState()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, stateMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, stateVersion); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(state)
+}
+
+// LoadState reads a snapshot created by SaveState and restores the Gameboy to
+// it. The snapshot must have been created with the same game loaded.
+func (gb *Gameboy) LoadState(r io.Reader) error {
+	if !gb.IsGameLoaded() {
+		return errors.New("no game loaded")
+	}
+
+	magic := make([]byte, len(stateMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fmt.Errorf("reading save state header: %v", err)
+	}
+	if string(magic) != stateMagic {
+		return errors.New("not a save state")
+	}
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return fmt.Errorf("reading save state version: %v", err)
+	}
+	if version > stateVersion {
+		return fmt.Errorf("save state version %v is newer than supported version %v", version, stateVersion)
+	}
+
+	state, err := decodeState(version, r)
+	if err != nil {
+		return fmt.Errorf("decoding save state: %v", err)
+	}
+	if state.CartTitle != gb.Memory.Cart.GetName() {
+		return fmt.Errorf("save state is for %q not %q", state.CartTitle, gb.Memory.Cart.GetName())
+	}
+	upgradeState(version, state)
+	return gb.setState(state)
+}
+
+// Decode the gob encoded state of a version of the save state format.
+func decodeState(version uint16, r io.Reader) (*gameboyState, error) {
+	if version >= 2 {
+		var state gameboyState
+		if err := gob.NewDecoder(r).Decode(&state); err != nil {
+			return nil, err
+		}
+		return &state, nil
+	}
+
+	// Version 1 states stored the screen matrices as arrays, apart from those
+	// written by development builds which already flattened them.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var legacy gameboyStateV1
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&legacy); err != nil {
+		var state gameboyState
+		if gob.NewDecoder(bytes.NewReader(data)).Decode(&state) != nil {
+			return nil, err
+		}
+		return &state, nil
+	}
+	return upgradeStateV1(&legacy), nil
+}
+
+// Convert a state decoded from version 1 of the save state format. The rest of
+// the upgrade is done by upgradeState.
+func upgradeStateV1(legacy *gameboyStateV1) *gameboyState {
+	return &gameboyState{
+		CartTitle:          legacy.CartTitle,
+		CPU:                legacy.CPU,
+		Memory:             legacy.Memory,
+		ScanlineCounter:    legacy.ScanlineCounter,
+		ScreenData:         flattenScreen(&legacy.ScreenData),
+		ScreenCleared:      legacy.ScreenCleared,
+		PreparedData:       flattenScreen(&legacy.PreparedData),
+		InterruptsEnabling: legacy.InterruptsEnabling,
+		InterruptsOn:       legacy.InterruptsOn,
+		Halted:             legacy.Halted,
+		InputMask:          legacy.InputMask,
+		CGBMode:            legacy.CGBMode,
+		BGPalette:          legacy.BGPalette,
+		SpritePalette:      legacy.SpritePalette,
+		CurrentSpeed:       legacy.CurrentSpeed,
+		PrepareSpeed:       legacy.PrepareSpeed,
+		Sound:              legacy.Sound,
+		Cart:               legacy.Cart,
+	}
+}
+
+// Upgrade a state loaded from an older version of the save state format.
+func upgradeState(version uint16, state *gameboyState) {
+	if version < 2 {
+		// The timer registers were stored in the high RAM
+		state.Timer = timerState{
+			Counter: uint16(state.Memory.HighRAM[0x04]) << 8,
+			TIMA:    state.Memory.HighRAM[0x05],
+			TMA:     state.Memory.HighRAM[0x06],
+			TAC:     state.Memory.HighRAM[0x07],
+		}
+	}
+	if version < 3 {
+		// The scanline counter counted down the cycles left in the scanline
+		dot := dotsScanline - state.ScanlineCounter
+		if dot < 0 {
+			dot = 0
+		}
+		state.PPU = ppuState{Dot: dot % dotsScanline}
+	}
+	if version < 4 {
+		// The PPU scanline was only stored in LY
+		state.PPU.Line = state.Memory.HighRAM[0x44]
+		state.PPU.LYCompare = int(state.PPU.Line)
+	}
+}
+
+// Build the state of the Gameboy to be written to a save state.
+func (gb *Gameboy) getState() (*gameboyState, error) {
+	sound, err := gb.Sound.SaveState()
+	if err != nil {
+		return nil, fmt.Errorf("saving apu state: %v", err)
+	}
+	cart, err := gb.Memory.Cart.SaveState()
+	if err != nil {
+		return nil, fmt.Errorf("saving cart state: %v", err)
+	}
+
+	mem := gb.Memory
+	return &gameboyState{
+		CartTitle: mem.Cart.GetName(),
+		CPU: cpuState{
+			AF: gb.CPU.AF.HiLo(),
+			BC: gb.CPU.BC.HiLo(),
+			DE: gb.CPU.DE.HiLo(),
+			HL: gb.CPU.HL.HiLo(),
+			SP: gb.CPU.SP.HiLo(),
+			PC: gb.CPU.PC,
+		},
+		Memory: memoryState{
+			HighRAM:    mem.HighRAM,
+			VRAM:       mem.VRAM,
+			VRAMBank:   mem.VRAMBank,
+			WRAM:       mem.WRAM,
+			WRAMBank:   mem.WRAMBank,
+			OAM:        mem.OAM,
+			HDMALength: mem.hdmaLength,
+			HDMAActive: mem.hdmaActive,
+			HDMAStall:  mem.hdmaStall,
+
+			DMAActive:      mem.dmaActive,
+			DMASource:      mem.dmaSource,
+			DMAIndex:       mem.dmaIndex,
+			DMAValue:       mem.dmaValue,
+			DMAStarting:    mem.dmaStarting,
+			DMAStartSource: mem.dmaStartSource,
+
+			BootROMEnabled: mem.bootROMEnabled,
+		},
+		Timer: timerState{
+			Counter:    gb.Timer.counter,
+			TIMA:       gb.Timer.tima,
+			TMA:        gb.Timer.tma,
+			TAC:        gb.Timer.tac,
+			Overflowed: gb.Timer.overflowed,
+			Reloading:  gb.Timer.reloading,
+		},
+		PPU:                gb.ppu,
+		ScreenData:         flattenScreen(&gb.screenData),
+		ScreenCleared:      gb.screenCleared,
+		PreparedData:       flattenScreen(&gb.PreparedData),
+		InterruptsEnabling: gb.interruptsEnabling,
+		InterruptsOn:       gb.interruptsOn,
+		Halted:             gb.halted,
+		HaltBug:            gb.haltBug,
+		Stopped:            gb.stopped,
+		InputMask:          gb.inputMask,
+		CGBMode:            gb.cgbMode,
+		DMGCompat:          gb.dmgCompat,
+		CompatPalettes:     gb.compatPalettes,
+		BGPalette:          *gb.BGPalette,
+		SpritePalette:      *gb.SpritePalette,
+		CurrentSpeed:       gb.currentSpeed,
+		PrepareSpeed:       gb.prepareSpeed,
+		Sound:              sound,
+		Cart:               cart,
+	}, nil
+}
+
+// Restore the Gameboy from the state loaded from a save state.
+func (gb *Gameboy) setState(state *gameboyState) error {
+	if err := gb.Sound.LoadState(state.Sound); err != nil {
+		return fmt.Errorf("loading apu state: %v", err)
+	}
+	if err := gb.Memory.Cart.LoadState(state.Cart); err != nil {
+		return fmt.Errorf("loading cart state: %v", err)
+	}
+
+	gb.CPU.AF.Set(state.CPU.AF)
+	gb.CPU.BC.Set(state.CPU.BC)
+	gb.CPU.DE.Set(state.CPU.DE)
+	gb.CPU.HL.Set(state.CPU.HL)
+	gb.CPU.SP.Set(state.CPU.SP)
+	gb.CPU.PC = state.CPU.PC
+
+	mem := gb.Memory
+	mem.HighRAM = state.Memory.HighRAM
+	mem.VRAM = state.Memory.VRAM
+	mem.VRAMBank = state.Memory.VRAMBank
+	mem.WRAM = state.Memory.WRAM
+	mem.WRAMBank = state.Memory.WRAMBank
+	mem.OAM = state.Memory.OAM
+	mem.hdmaLength = state.Memory.HDMALength
+	mem.hdmaActive = state.Memory.HDMAActive
+	mem.hdmaStall = state.Memory.HDMAStall
+	mem.dmaActive = state.Memory.DMAActive
+	mem.dmaSource = state.Memory.DMASource
+	mem.dmaIndex = state.Memory.DMAIndex
+	mem.dmaValue = state.Memory.DMAValue
+	mem.dmaStarting = state.Memory.DMAStarting
+	mem.dmaStartSource = state.Memory.DMAStartSource
+	mem.bootROMEnabled = state.Memory.BootROMEnabled && mem.bootROM != nil
+
+	gb.Timer.counter = state.Timer.Counter
+	gb.Timer.tima = state.Timer.TIMA
+	gb.Timer.tma = state.Timer.TMA
+	gb.Timer.tac = state.Timer.TAC
+	gb.Timer.overflowed = state.Timer.Overflowed
+	gb.Timer.reloading = state.Timer.Reloading
+
+	gb.ppu = state.PPU
+	unflattenScreen(&gb.screenData, state.ScreenData)
+	gb.screenCleared = state.ScreenCleared
+	unflattenScreen(&gb.PreparedData, state.PreparedData)
+	gb.interruptsEnabling = state.InterruptsEnabling
+	gb.interruptsOn = state.InterruptsOn
+	gb.halted = state.Halted
+	gb.haltBug = state.HaltBug
+	gb.stopped = state.Stopped
+	gb.inputMask = state.InputMask
+	gb.cgbMode = state.CGBMode
+	gb.dmgCompat = state.DMGCompat
+	gb.compatPalettes = state.CompatPalettes
+	*gb.BGPalette = state.BGPalette
+	*gb.SpritePalette = state.SpritePalette
+	gb.currentSpeed = state.CurrentSpeed
+	gb.prepareSpeed = state.PrepareSpeed
+	return nil
+}
+
+// Flatten a screen matrix into a byte array.
+func flattenScreen(screen *[ScreenWidth][ScreenHeight][3]uint8) []byte {
+	data := make([]byte, 0, ScreenWidth*ScreenHeight*3)
+	for x := range screen {
+		for y := range screen[x] {
+			data = append(data, screen[x][y][:]...)
+		}
+	}
+	return data
+}
+
+// Load a byte array created by flattenScreen into a screen matrix.
+func unflattenScreen(screen *[ScreenWidth][ScreenHeight][3]uint8, data []byte) {
+	*screen = [ScreenWidth][ScreenHeight][3]uint8{}
+	for i := 0; i+2 < len(data) && i < ScreenWidth*ScreenHeight*3; i += 3 {
+		pixel := i / 3
+		copy(screen[pixel/ScreenHeight][pixel%ScreenHeight][:], data[i:i+3])
+	}
+}
@@ -0,0 +1,86 @@
+package gb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSaveState asserts that restoring a save state resumes execution from
+// exactly the same point as when the state was saved.
+func TestSaveState(t *testing.T) {
+	output := ""
+	gb, err := NewGameboy("./../../roms/blargg/cpu_instrs.gb", WithTransferFunction(func(val byte) {
+		output += string(val)
+	}))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	for i := 0; i < 200; i++ {
+		gb.Update()
+	}
+
+	var state bytes.Buffer
+	require.NoError(t, gb.SaveState(&state))
+	saved := state.Bytes()
+	savedOutput := output
+
+	runFrames := func() ([ScreenWidth][ScreenHeight][3]uint8, CPU, string) {
+		output = savedOutput
+		for i := 0; i < 100; i++ {
+			gb.Update()
+		}
+		return gb.PreparedData, *gb.CPU, output
+	}
+	expectedFrame, expectedCPU, expectedOutput := runFrames()
+
+	require.NoError(t, gb.LoadState(bytes.NewReader(saved)))
+	actualFrame, actualCPU, actualOutput := runFrames()
+
+	assert.Equal(t, expectedCPU, actualCPU, "cpu state does not match")
+	assert.Equal(t, expectedOutput, actualOutput, "serial output does not match")
+	assert.True(t, expectedFrame == actualFrame, "frame does not match")
+}
+
+// TestLoadState_InvalidState asserts that loading something which is not a
+// save state returns an error.
+func TestLoadState_InvalidState(t *testing.T) {
+	gb, err := NewGameboy("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+
+	assert.Error(t, gb.LoadState(bytes.NewReader([]byte("not a save state"))))
+}
+
+// TestLoadState_Version1 asserts that a save state written by version 1 of the
+// format, which stored the screen matrices as arrays, can still be loaded. The
+// state was saved after 200 frames of cpu_instrs.
+func TestLoadState_Version1(t *testing.T) {
+	gb, err := NewGameboy("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+
+	f, err := os.Open("testdata/state-v1.gob.gz")
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	require.NoError(t, gb.LoadState(r))
+	assert.Equal(t, uint16(0xC304), gb.CPU.PC, "pc does not match")
+
+	blank := true
+	for x := range gb.PreparedData {
+		for y := range gb.PreparedData[x] {
+			if gb.PreparedData[x][y] != gb.PreparedData[0][0] {
+				blank = false
+			}
+		}
+	}
+	assert.False(t, blank, "screen was not restored")
+
+	for i := 0; i < 100; i++ {
+		gb.Update()
+	}
+}
@@ -0,0 +1,73 @@
+package gb
+
+// Maximum number of frames that RunUntilScanline will run for before giving up
+// on reaching the scanline.
+const maxScanlineFrames = 2
+
+// StepInstruction executes a single instruction and updates the rest of the
+// Gameboy by the cycles it took, including servicing any interrupts. If the CPU
+// is halted then the Gameboy is advanced by a single machine cycle. Returns the
+// number of cycles which were taken.
+//
+// When a frame is finished the same work is done as at the end of Update, so
+// the audio is flushed to the sink, the cartridge RAM is periodically saved and
+// rewind snapshots are taken while the Gameboy is run with any of the stepping
+// functions.
+func (gb *Gameboy) StepInstruction() int {
+	return gb.step()
+}
+
+// RunCycles runs instructions until at least n cycles have passed. Instructions
+// are not split, so the returned number of cycles which were run may be larger
+// than n.
+func (gb *Gameboy) RunCycles(n int) int {
+	cycles := 0
+	for cycles < n {
+		cycles += gb.step()
+	}
+	return cycles
+}
+
+// RunUntil runs instructions until the condition returns true. The condition is
+// checked after each instruction. Returns the number of cycles which were run.
+// This will run forever if the condition is never met.
+func (gb *Gameboy) RunUntil(condition func(*Gameboy) bool) int {
+	cycles := 0
+	for !condition(gb) {
+		cycles += gb.step()
+	}
+	return cycles
+}
+
+// RunUntilScanline runs instructions until the PPU starts drawing a scanline. If
+// the PPU is already on the scanline then it will run until the scanline is next
+// reached. Returns the number of cycles which were run, and if the scanline was
+// reached. The scanline will not be reached if the LCD is disabled, in which case
+// the Gameboy will be run for a number of frames before giving up.
+func (gb *Gameboy) RunUntilScanline(ly byte) (int, bool) {
+	// The PPU line is used instead of LY, which reads 0 early during line 153.
+	// The scanline is reached once its first dot has been drawn, which is when
+	// LY changes.
+	onLine := func() bool {
+		return gb.ppu.Line == ly && gb.ppu.Dot > 0
+	}
+
+	maxCycles := maxScanlineFrames * CyclesFrame * gb.getSpeed()
+	cycles := 0
+	previous := gb.ppu.Line == ly
+	for cycles < maxCycles {
+		cycles += gb.step()
+		current := onLine()
+		if current && !previous {
+			return cycles, true
+		}
+		previous = current
+	}
+	return cycles, false
+}
+
+// RunUntilVBlank runs instructions until the PPU enters the VBlank period at the
+// end of a frame. See RunUntilScanline.
+func (gb *Gameboy) RunUntilVBlank() (int, bool) {
+	return gb.RunUntilScanline(ScreenHeight)
+}
@@ -0,0 +1,89 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/Humpheh/goboy/pkg/apu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCycles(t *testing.T) {
+	gb, err := NewGameboy("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+
+	cycles := gb.RunCycles(1000)
+	assert.True(t, cycles >= 1000, "ran fewer cycles than requested: %v", cycles)
+	assert.True(t, cycles < 1100, "ran too many cycles: %v", cycles)
+}
+
+func TestRunUntilScanline(t *testing.T) {
+	gb, err := NewGameboy("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+
+	_, ok := gb.RunUntilScanline(100)
+	require.True(t, ok, "did not reach scanline")
+	assert.Equal(t, byte(100), gb.Memory.ReadHighRam(0xFF44))
+
+	_, ok = gb.RunUntilVBlank()
+	require.True(t, ok, "did not reach vblank")
+	assert.Equal(t, byte(ScreenHeight), gb.Memory.ReadHighRam(0xFF44))
+}
+
+func TestRunUntil(t *testing.T) {
+	gb, err := NewGameboy("./../../roms/blargg/cpu_instrs.gb")
+	require.NoError(t, err, "error in init gb %v", err)
+
+	steps := 0
+	gb.RunUntil(func(*Gameboy) bool {
+		steps++
+		return steps == 10
+	})
+	assert.Equal(t, 10, steps)
+}
+
+func TestStepInstruction(t *testing.T) {
+	gb, err := NewGameboyFromROM(programROM(
+		0x00,       // NOP
+		0x3E, 0x42, // LD A,0x42
+		0x18, 0xFE, // JR -2
+	))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	assert.Equal(t, 4, gb.StepInstruction())
+	assert.Equal(t, uint16(0x101), gb.CPU.PC)
+	assert.Equal(t, 8, gb.StepInstruction())
+	assert.Equal(t, uint16(0x103), gb.CPU.PC)
+	assert.Equal(t, byte(0x42), gb.CPU.AF.Hi())
+	assert.Equal(t, 12, gb.StepInstruction())
+	assert.Equal(t, uint16(0x103), gb.CPU.PC)
+}
+
+// TestStepInstruction_EndFrame asserts that the work at the end of each frame
+// is done when the Gameboy is stepped instead of updated.
+func TestStepInstruction_EndFrame(t *testing.T) {
+	sink := &apu.MemorySink{}
+	gb, err := NewGameboyFromROM(programROM(0x18, 0xFE), WithAudioSink(sink), WithRewind(1, 1<<20))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	for i := 0; i < 3*CyclesFrame; {
+		i += gb.StepInstruction()
+	}
+	assert.Equal(t, 3, gb.frames)
+	assert.NotEmpty(t, sink.Frames, "audio should be flushed at the end of the frame")
+	assert.NotNil(t, gb.rewind.newest, "rewind snapshot should be taken")
+}
+
+// TestRunUntilScanline_Zero asserts that running until line 0 stops at the
+// start of the frame, not when LY reads 0 early during line 153.
+func TestRunUntilScanline_Zero(t *testing.T) {
+	gb, err := NewGameboyFromROM(programROM(0x18, 0xFE))
+	require.NoError(t, err, "error in init gb %v", err)
+
+	cycles, ok := gb.RunUntilScanline(0)
+	require.True(t, ok, "did not reach scanline")
+	assert.InDelta(t, CyclesFrame, cycles, 24, "should run for a frame")
+	assert.Equal(t, byte(0), gb.ppu.Line)
+	assert.True(t, gb.ppu.Dot < 24, "should stop at the start of line 0, stopped at dot %v", gb.ppu.Dot)
+	assert.Equal(t, byte(0), gb.Memory.ReadHighRam(0xFF44))
+}
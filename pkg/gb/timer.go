@@ -0,0 +1,136 @@
+package gb
+
+import (
+	"github.com/Humpheh/goboy/pkg/bits"
+)
+
+// Bit of the system counter which clocks TIMA for each of the TAC frequencies.
+var timerBits = [4]uint16{
+	9, // 4096 Hz
+	3, // 262144 Hz
+	5, // 65536 Hz
+	7, // 16384 Hz
+}
+
+// Timer is the Gameboy timer. It is driven by a 16-bit system counter which is
+// incremented every cycle, with the DIV register exposing the upper 8 bits of
+// the counter. TIMA is incremented on the falling edge of one of the counter
+// bits (selected by TAC) ANDed with the timer enable bit, so writes to DIV and
+// TAC can also cause TIMA to increment.
+type Timer struct {
+	gb *Gameboy
+
+	// Internal system counter, DIV is the upper byte.
+	counter uint16
+
+	tima byte
+	tma  byte
+	tac  byte
+
+	// Set when TIMA has overflowed. TIMA reads as 0 for one M-cycle before it
+	// is reloaded from TMA and the interrupt is requested.
+	overflowed bool
+	// Set during the M-cycle where TIMA has been reloaded from TMA. Writes to
+	// TIMA in this cycle are ignored, and writes to TMA are also copied to TIMA.
+	reloading bool
+}
+
+// Init the timer to the state left by the boot ROM of a model.
+func (t *Timer) Init(gameboy *Gameboy) {
+	t.gb = gameboy
+	t.tac = 0xF8
+	if gameboy.options.bootROM != nil {
+		return
+	}
+
+	switch gameboy.options.model {
+	case ModelDMG0:
+		t.counter = 0x1830
+	case ModelDMG, ModelMGB:
+		t.counter = 0xABCC
+	default:
+		t.counter = 0x1E00
+	}
+}
+
+// Tick the timer by a number of cycles.
+func (t *Timer) Tick(cycles int) {
+	for i := 0; i < cycles; i += 4 {
+		t.reloading = false
+		if t.overflowed {
+			t.overflowed = false
+			t.reloading = true
+			t.tima = t.tma
+			t.gb.requestInterrupt(2)
+		}
+		t.setCounter(t.counter + 4)
+	}
+}
+
+// Get the input to the falling edge detector which increments TIMA.
+func (t *Timer) signal() bool {
+	return bits.Test(t.tac, 2) && t.counter&(1<<timerBits[t.tac&0x3]) != 0
+}
+
+// Set the value of the system counter, incrementing TIMA if it causes a
+// falling edge on the selected bit. A falling edge on bit 4 of DIV, or bit 5
+// in double speed mode, steps the frame sequencer of the APU.
+func (t *Timer) setCounter(value uint16) {
+	previous := t.signal()
+	sequencerBit := uint16(1) << uint(11+t.gb.getSpeed())
+	sequencerPrevious := t.counter&sequencerBit != 0
+	t.counter = value
+	t.checkFallingEdge(previous)
+	if sequencerPrevious && t.counter&sequencerBit == 0 {
+		t.gb.Sound.StepFrameSequencer()
+	}
+}
+
+// Increment TIMA if the signal has fallen since its previous value.
+func (t *Timer) checkFallingEdge(previous bool) {
+	if previous && !t.signal() {
+		t.tima++
+		if t.tima == 0 {
+			t.overflowed = true
+		}
+	}
+}
+
+// Read one of the timer registers.
+func (t *Timer) Read(address uint16) byte {
+	switch address {
+	case DIV:
+		return byte(t.counter >> 8)
+	case TIMA:
+		return t.tima
+	case TMA:
+		return t.tma
+	default:
+		return t.tac | 0xF8
+	}
+}
+
+// Write to one of the timer registers.
+func (t *Timer) Write(address uint16, value byte) {
+	switch address {
+	case DIV:
+		// Writing any value resets the whole system counter
+		t.setCounter(0)
+	case TIMA:
+		if t.reloading {
+			return
+		}
+		// Writing during the overflow cycle cancels the reload
+		t.tima = value
+		t.overflowed = false
+	case TMA:
+		t.tma = value
+		if t.reloading {
+			t.tima = value
+		}
+	default:
+		previous := t.signal()
+		t.tac = value | 0xF8
+		t.checkFallingEdge(previous)
+	}
+}